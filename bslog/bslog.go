@@ -5,34 +5,292 @@
 package bslog
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Level is the severity of a log line.
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// maxRepeatedKeys bounds the number of distinct error lines tracked for rate
+// limiting, expired entries are pruned once it's reached.
+const maxRepeatedKeys = 256
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	}
+	return "unknown"
+}
+
+// label is the level as printed in the text format.
+func (l Level) label() string {
+	if l == WarnLevel {
+		return "WARNING"
+	}
+	return strings.ToUpper(l.String())
+}
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("invalid log level %q", name)
+}
+
+// Config holds the logging settings.
+type Config struct {
+	// Format is either TextFormat or JSONFormat.
+	Format string
+	// Level is the minimum level of logged lines.
+	Level Level
+	// ComponentLevels overrides Level for the lines of a component, the
+	// bracketed prefix of messages, like "log forwarder".
+	ComponentLevels map[string]Level
+	// RepeatInterval is the window in which repeated error lines are
+	// suppressed, zero disables suppression.
+	RepeatInterval time.Duration
+	// Debug forces the debug level, like the Debug variable.
+	Debug bool
+}
+
+// Debug forces the debug level, except for components with a level set in
+// ComponentLevels.
 var Debug bool
 
 var Logger = log.New(os.Stderr, "", log.LstdFlags)
 
-func Debugf(msg string, params ...interface{}) {
-	if Debug {
-		logPrintf("DEBUG", msg, params...)
+var state = struct {
+	sync.Mutex
+	config   Config
+	repeated map[string]*repeatedLine
+}{
+	config:   Config{Format: TextFormat, Level: InfoLevel},
+	repeated: make(map[string]*repeatedLine),
+}
+
+// afterFunc schedules the report of suppressed lines, replaced in tests.
+var afterFunc = time.AfterFunc
+
+type repeatedLine struct {
+	first      time.Time
+	suppressed int
+	timer      *time.Timer
+}
+
+// Configure replaces the logging settings. Suppressed lines not reported
+// yet are logged with the previous settings.
+func Configure(c Config) {
+	state.Lock()
+	format := state.config.Format
+	now := time.Now()
+	var pending []string
+	for text, line := range state.repeated {
+		if line.timer != nil {
+			line.timer.Stop()
+		}
+		if line.suppressed > 0 {
+			pending = append(pending, repeatedText(text, line, now))
+		}
 	}
+	state.config = c
+	state.repeated = make(map[string]*repeatedLine)
+	state.Unlock()
+	for _, text := range pending {
+		write(ErrorLevel, format, text)
+	}
+}
+
+func Debugf(msg string, params ...interface{}) {
+	logPrintf(DebugLevel, msg, params...)
+}
+
+func Infof(msg string, params ...interface{}) {
+	logPrintf(InfoLevel, msg, params...)
 }
 
 func Warnf(msg string, params ...interface{}) {
-	logPrintf("WARNING", msg, params...)
+	logPrintf(WarnLevel, msg, params...)
 }
 
 func Errorf(msg string, params ...interface{}) {
-	logPrintf("ERROR", msg, params...)
+	logPrintf(ErrorLevel, msg, params...)
 }
 
 func Fatalf(msg string, params ...interface{}) {
-	Logger.Fatalf(msg, params...)
+	state.Lock()
+	format := state.config.Format
+	state.Unlock()
+	if format != JSONFormat {
+		Logger.Fatalf(msg, params...)
+	}
+	text := strings.TrimSuffix(fmt.Sprintf(msg, params...), "\n")
+	writeJSON(Logger, "fatal", text)
+	os.Exit(1)
 }
 
-func logPrintf(level string, msg string, params ...interface{}) {
-	msg = fmt.Sprintf("[%s] %s", level, msg)
-	Logger.Printf(msg, params...)
+func logPrintf(level Level, msg string, params ...interface{}) {
+	text := strings.TrimSuffix(fmt.Sprintf(msg, params...), "\n")
+	state.Lock()
+	if !enabled(level, component(text)) {
+		state.Unlock()
+		return
+	}
+	text, ok := checkRepeated(level, text)
+	format := state.config.Format
+	state.Unlock()
+	if ok {
+		write(level, format, text)
+	}
+}
+
+func write(level Level, format, text string) {
+	if format == JSONFormat {
+		writeJSON(Logger, level.String(), text)
+		return
+	}
+	Logger.Print("[" + level.label() + "] " + text)
+}
+
+// enabled reports whether lines with the level are logged for the
+// component. It must be called with the state lock held.
+func enabled(level Level, component string) bool {
+	if threshold, ok := state.config.ComponentLevels[component]; ok {
+		return level >= threshold
+	}
+	if Debug || state.config.Debug {
+		return true
+	}
+	return level >= state.config.Level
+}
+
+// checkRepeated suppresses error lines repeated within the repeat interval,
+// returning false for suppressed lines. The number of suppressed lines is
+// logged once the interval expires, by the first line logged after it or by
+// a timer if the line isn't logged again. It must be called with the state
+// lock held.
+func checkRepeated(level Level, text string) (string, bool) {
+	interval := state.config.RepeatInterval
+	if level < ErrorLevel || interval <= 0 {
+		return text, true
+	}
+	now := time.Now()
+	key := text
+	line := state.repeated[key]
+	if line != nil && now.Sub(line.first) < interval {
+		line.suppressed++
+		if line.timer == nil {
+			line.timer = afterFunc(interval-now.Sub(line.first), func() {
+				reportRepeated(key, line)
+			})
+		}
+		return text, false
+	}
+	if line != nil {
+		if line.timer != nil {
+			line.timer.Stop()
+		}
+		if line.suppressed > 0 {
+			text = repeatedText(text, line, now)
+		}
+	}
+	if line == nil && len(state.repeated) >= maxRepeatedKeys {
+		for k, l := range state.repeated {
+			if l.suppressed == 0 && now.Sub(l.first) >= interval {
+				delete(state.repeated, k)
+			}
+		}
+	}
+	if line == nil && len(state.repeated) >= maxRepeatedKeys {
+		return text, true
+	}
+	state.repeated[key] = &repeatedLine{first: now}
+	return text, true
+}
+
+// reportRepeated logs the number of times the line was suppressed, unless it
+// was already reported by a new occurrence of the line.
+func reportRepeated(key string, line *repeatedLine) {
+	state.Lock()
+	if state.repeated[key] != line || line.suppressed == 0 {
+		state.Unlock()
+		return
+	}
+	text := repeatedText(key, line, time.Now())
+	delete(state.repeated, key)
+	format := state.config.Format
+	state.Unlock()
+	write(ErrorLevel, format, text)
+}
+
+func repeatedText(text string, line *repeatedLine, now time.Time) string {
+	return fmt.Sprintf("%s (repeated %d times in the last %s)", text, line.suppressed, now.Sub(line.first).Round(time.Second))
+}
+
+// component returns the component of a message, the bracketed prefix like
+// in "[log forwarder] unable to connect".
+func component(text string) string {
+	if !strings.HasPrefix(text, "[") {
+		return ""
+	}
+	end := strings.Index(text, "] ")
+	if end < 0 {
+		return ""
+	}
+	return text[1:end]
+}
+
+func writeJSON(logger *log.Logger, level, text string) {
+	line := struct {
+		Time      string `json:"time"`
+		Level     string `json:"level"`
+		Component string `json:"component,omitempty"`
+		Msg       string `json:"msg"`
+	}{
+		Time:  time.Now().UTC().Format(time.RFC3339Nano),
+		Level: level,
+		Msg:   text,
+	}
+	if c := component(text); c != "" {
+		line.Component = c
+		line.Msg = text[len(c)+3:]
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		logger.Printf("[ERROR] unable to encode log line: %s", err)
+		return
+	}
+	logger.Writer().Write(append(data, '\n'))
 }
@@ -0,0 +1,184 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(S{})
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+// captureLogs configures logging to a buffer, resetting the tracked repeated
+// lines. The returned function restores the previous logger.
+func captureLogs(c Config) (*bytes.Buffer, func()) {
+	prevLogger := Logger
+	var buf bytes.Buffer
+	Logger = log.New(&buf, "", 0)
+	Configure(c)
+	return &buf, func() {
+		Logger = prevLogger
+		Configure(Config{Format: TextFormat, Level: InfoLevel})
+	}
+}
+
+func (S) TestParseLevel(c *check.C) {
+	for name, expected := range map[string]Level{
+		"debug":   DebugLevel,
+		"INFO":    InfoLevel,
+		"warn":    WarnLevel,
+		"warning": WarnLevel,
+		" error ": ErrorLevel,
+	} {
+		level, err := ParseLevel(name)
+		c.Check(err, check.IsNil)
+		c.Check(level, check.Equals, expected)
+	}
+	_, err := ParseLevel("verbose")
+	c.Assert(err, check.ErrorMatches, `invalid log level "verbose"`)
+}
+
+func (S) TestLevelThreshold(c *check.C) {
+	buf, restore := captureLogs(Config{Format: TextFormat, Level: WarnLevel})
+	defer restore()
+	Debugf("debug line")
+	Infof("info line")
+	Warnf("warn line")
+	Errorf("error line %d", 1)
+	c.Assert(buf.String(), check.Equals, "[WARNING] warn line\n[ERROR] error line 1\n")
+}
+
+func (S) TestDebugForcesDebugLevel(c *check.C) {
+	buf, restore := captureLogs(Config{Format: TextFormat, Level: ErrorLevel})
+	defer restore()
+	Debug = true
+	defer func() { Debug = false }()
+	Debugf("debug line")
+	c.Assert(buf.String(), check.Equals, "[DEBUG] debug line\n")
+}
+
+func (S) TestComponentLevels(c *check.C) {
+	buf, restore := captureLogs(Config{
+		Format: TextFormat,
+		Level:  InfoLevel,
+		ComponentLevels: map[string]Level{
+			"log forwarder": ErrorLevel,
+			"host check":    DebugLevel,
+		},
+	})
+	defer restore()
+	Warnf("[log forwarder] ignored")
+	Errorf("[log forwarder] logged")
+	Debugf("[host check] logged")
+	Debugf("[status reporter] ignored")
+	Infof("[status reporter] logged")
+	c.Assert(buf.String(), check.Equals, "[ERROR] [log forwarder] logged\n[DEBUG] [host check] logged\n[INFO] [status reporter] logged\n")
+}
+
+func (S) TestJSONFormat(c *check.C) {
+	buf, restore := captureLogs(Config{Format: JSONFormat, Level: InfoLevel})
+	defer restore()
+	Warnf("[status reporter] unable to send %d units", 2)
+	Infof("no component")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	c.Assert(lines, check.HasLen, 2)
+	var line map[string]string
+	err := json.Unmarshal([]byte(lines[0]), &line)
+	c.Assert(err, check.IsNil)
+	_, err = time.Parse(time.RFC3339Nano, line["time"])
+	c.Assert(err, check.IsNil)
+	delete(line, "time")
+	c.Assert(line, check.DeepEquals, map[string]string{
+		"level":     "warn",
+		"component": "status reporter",
+		"msg":       "unable to send 2 units",
+	})
+	line = nil
+	err = json.Unmarshal([]byte(lines[1]), &line)
+	c.Assert(err, check.IsNil)
+	delete(line, "time")
+	c.Assert(line, check.DeepEquals, map[string]string{"level": "info", "msg": "no component"})
+}
+
+// stubTimers replaces the timers reporting suppressed lines by timers which
+// never fire, returning the report functions scheduled.
+func stubTimers() (*[]func(), func()) {
+	var reports []func()
+	afterFunc = func(d time.Duration, f func()) *time.Timer {
+		reports = append(reports, f)
+		return time.NewTimer(time.Hour)
+	}
+	return &reports, func() { afterFunc = time.AfterFunc }
+}
+
+func (S) TestRepeatedErrorsSuppressed(c *check.C) {
+	buf, restore := captureLogs(Config{Format: TextFormat, Level: InfoLevel, RepeatInterval: 50 * time.Millisecond})
+	defer restore()
+	_, restoreTimers := stubTimers()
+	defer restoreTimers()
+	for i := 0; i < 3; i++ {
+		Errorf("[log forwarder] unable to connect: %s", "connection refused")
+		Warnf("[log forwarder] warnings are not suppressed")
+	}
+	Errorf("[log forwarder] other error")
+	c.Assert(buf.String(), check.Equals, "[ERROR] [log forwarder] unable to connect: connection refused\n"+
+		strings.Repeat("[WARNING] [log forwarder] warnings are not suppressed\n", 3)+
+		"[ERROR] [log forwarder] other error\n")
+	buf.Reset()
+	time.Sleep(60 * time.Millisecond)
+	Errorf("[log forwarder] unable to connect: %s", "connection refused")
+	c.Assert(buf.String(), check.Matches, `\[ERROR\] \[log forwarder\] unable to connect: connection refused \(repeated 2 times in the last .*\)\n`)
+	buf.Reset()
+	Errorf("[log forwarder] unable to connect: %s", "connection refused")
+	c.Assert(buf.String(), check.Equals, "")
+}
+
+func (S) TestRepeatedErrorsReportedByTimer(c *check.C) {
+	buf, restore := captureLogs(Config{Format: TextFormat, Level: InfoLevel, RepeatInterval: time.Minute})
+	defer restore()
+	reports, restoreTimers := stubTimers()
+	defer restoreTimers()
+	Errorf("repeated error")
+	Errorf("repeated error")
+	Errorf("repeated error")
+	c.Assert(*reports, check.HasLen, 1)
+	c.Assert(buf.String(), check.Equals, "[ERROR] repeated error\n")
+	buf.Reset()
+	(*reports)[0]()
+	c.Assert(buf.String(), check.Matches, `\[ERROR\] repeated error \(repeated 2 times in the last .*\)\n`)
+	buf.Reset()
+	(*reports)[0]()
+	c.Assert(buf.String(), check.Equals, "")
+	Errorf("repeated error")
+	c.Assert(buf.String(), check.Equals, "[ERROR] repeated error\n")
+}
+
+func (S) TestRepeatedErrorsReportedOnConfigure(c *check.C) {
+	buf, restore := captureLogs(Config{Format: TextFormat, Level: InfoLevel, RepeatInterval: time.Minute})
+	defer restore()
+	_, restoreTimers := stubTimers()
+	defer restoreTimers()
+	Errorf("repeated error")
+	Errorf("repeated error")
+	Errorf("other error")
+	buf.Reset()
+	Configure(Config{Format: JSONFormat, Level: InfoLevel, RepeatInterval: time.Minute})
+	c.Assert(buf.String(), check.Matches, `\[ERROR\] repeated error \(repeated 1 times in the last .*\)\n`)
+	buf.Reset()
+	Errorf("repeated error")
+	c.Assert(buf.String(), check.Matches, `\{.*"msg":"repeated error"\}\n`)
+}
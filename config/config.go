@@ -21,39 +21,114 @@ const (
 	DefaultDockerEndpoint = "unix:///var/run/docker.sock"
 )
 
-var Config struct {
-	DockerEndpoint      string
-	TsuruEndpoint       string
-	TsuruToken          string
-	MetricsInterval     time.Duration
-	MetricsBackend      string
-	MetricsEnable       bool
-	MetricsEnableBasic  bool
-	MetricsEnableConn   bool
-	MetricsEnableHost   bool
-	StatusInterval      time.Duration
-	SyslogListenAddress string
-	LogBackends         []string
+// Settings holds the bs settings read from the environment.
+type Settings struct {
+	DockerEndpoint       string
+	TsuruEndpoint        string
+	TsuruToken           string
+	MetricsInterval      time.Duration
+	MetricsBackend       string
+	MetricsEnable        bool
+	MetricsEnableBasic   bool
+	MetricsEnableConn    bool
+	MetricsEnableHost    bool
+	MetricsTelemetry     bool
+	HTTPListenAddress    string
+	StatusInterval       time.Duration
+	StatusEvents         bool
+	StatusEventsDebounce time.Duration
+	ZombieCycles         int
+	ZombieMinAge         time.Duration
+	ZombieMaxRemovals    int
+	ZombieDryRun         bool
+	ZombieAction         string
+	StatusPayloadFormat  string
+	SyslogListenAddress  string
+	LogBackends          []string
 }
 
+// Config holds the settings loaded when bs starts. It's not updated when the
+// configuration is reloaded, Load returns the reloaded settings instead.
+var Config Settings
+
 func init() {
 	LoadConfig()
 }
 
+// LoadConfig loads the settings into Config. It must not be called while
+// other goroutines read Config.
 func LoadConfig() {
-	bslog.Debug, _ = strconv.ParseBool(os.Getenv("BS_DEBUG"))
-	Config.DockerEndpoint = StringEnvOrDefault(DefaultDockerEndpoint, "DOCKER_ENDPOINT")
-	Config.TsuruEndpoint = os.Getenv("TSURU_ENDPOINT")
-	Config.TsuruToken = os.Getenv("TSURU_TOKEN")
-	Config.SyslogListenAddress = os.Getenv("SYSLOG_LISTEN_ADDRESS")
-	Config.StatusInterval = SecondsEnvOrDefault(DefaultInterval, "STATUS_INTERVAL")
-	Config.MetricsInterval = SecondsEnvOrDefault(DefaultInterval, "METRICS_INTERVAL")
-	Config.MetricsBackend = os.Getenv("METRICS_BACKEND")
-	Config.LogBackends = StringsEnvOrDefault([]string{"tsuru", "syslog"}, "LOG_BACKENDS")
-	Config.MetricsEnable = BoolEnvOrDefault(true, "METRICS_ENABLE")
-	Config.MetricsEnableBasic = BoolEnvOrDefault(true, "METRICS_ENABLE_BASIC")
-	Config.MetricsEnableConn = BoolEnvOrDefault(true, "METRICS_ENABLE_CONN")
-	Config.MetricsEnableHost = BoolEnvOrDefault(true, "METRICS_ENABLE_HOST")
+	Config = Load()
+}
+
+// Load reads the config files and the environment, applying the logging
+// settings and returning the other settings.
+func Load() Settings {
+	loadFiles()
+	bslog.Configure(loggingConfig())
+	var s Settings
+	s.DockerEndpoint = StringEnvOrDefault(DefaultDockerEndpoint, "DOCKER_ENDPOINT")
+	s.TsuruEndpoint = os.Getenv("TSURU_ENDPOINT")
+	s.TsuruToken = os.Getenv("TSURU_TOKEN")
+	s.SyslogListenAddress = os.Getenv("SYSLOG_LISTEN_ADDRESS")
+	s.StatusInterval = SecondsEnvOrDefault(DefaultInterval, "STATUS_INTERVAL")
+	s.StatusEvents = BoolEnvOrDefault(true, "STATUS_EVENTS_ENABLE")
+	s.StatusEventsDebounce = SecondsEnvOrDefault(1, "STATUS_EVENTS_DEBOUNCE")
+	s.ZombieCycles = IntEnvOrDefault(3, "STATUS_ZOMBIE_CYCLES")
+	s.ZombieMinAge = SecondsEnvOrDefault(300, "STATUS_ZOMBIE_MIN_AGE")
+	s.ZombieMaxRemovals = IntEnvOrDefault(5, "STATUS_ZOMBIE_MAX_REMOVALS")
+	s.ZombieDryRun = BoolEnvOrDefault(false, "STATUS_ZOMBIE_DRY_RUN")
+	s.ZombieAction = StringEnvOrDefault("remove", "STATUS_ZOMBIE_ACTION")
+	s.StatusPayloadFormat = StringEnvOrDefault("auto", "STATUS_PAYLOAD_FORMAT")
+	s.MetricsInterval = SecondsEnvOrDefault(DefaultInterval, "METRICS_INTERVAL")
+	s.MetricsBackend = os.Getenv("METRICS_BACKEND")
+	s.LogBackends = StringsEnvOrDefault([]string{"tsuru", "syslog"}, "LOG_BACKENDS")
+	s.MetricsEnable = BoolEnvOrDefault(true, "METRICS_ENABLE")
+	s.MetricsEnableBasic = BoolEnvOrDefault(true, "METRICS_ENABLE_BASIC")
+	s.MetricsEnableConn = BoolEnvOrDefault(true, "METRICS_ENABLE_CONN")
+	s.MetricsEnableHost = BoolEnvOrDefault(true, "METRICS_ENABLE_HOST")
+	s.MetricsTelemetry = BoolEnvOrDefault(true, "METRICS_ENABLE_TELEMETRY")
+	s.HTTPListenAddress = StringEnvOrDefault("", "HTTP_LISTEN_ADDRESS")
+	return s
+}
+
+// loggingConfig returns the bslog settings from BS_DEBUG, BS_LOG_FORMAT,
+// BS_LOG_LEVEL, BS_LOG_LEVELS and BS_LOG_REPEAT_INTERVAL.
+func loggingConfig() bslog.Config {
+	c := bslog.Config{
+		Format:          bslog.TextFormat,
+		Level:           bslog.InfoLevel,
+		ComponentLevels: make(map[string]bslog.Level),
+		RepeatInterval:  time.Minute,
+	}
+	c.Debug, _ = strconv.ParseBool(os.Getenv("BS_DEBUG"))
+	if os.Getenv("BS_LOG_REPEAT_INTERVAL") != "" {
+		c.RepeatInterval = SecondsEnvOrDefault(60, "BS_LOG_REPEAT_INTERVAL")
+	}
+	if format := os.Getenv("BS_LOG_FORMAT"); format == bslog.JSONFormat {
+		c.Format = format
+	}
+	if name := os.Getenv("BS_LOG_LEVEL"); name != "" {
+		level, err := bslog.ParseLevel(name)
+		if err != nil {
+			bslog.Warnf("invalid value for BS_LOG_LEVEL: %s. Using the default value of %s", err, c.Level)
+		}
+		c.Level = level
+	}
+	for _, entry := range StringsEnvOrDefault(nil, "BS_LOG_LEVELS") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			bslog.Warnf("invalid entry in BS_LOG_LEVELS: %q, expected component=level", entry)
+			continue
+		}
+		level, err := bslog.ParseLevel(parts[1])
+		if err != nil {
+			bslog.Warnf("invalid entry in BS_LOG_LEVELS: %s", err)
+			continue
+		}
+		c.ComponentLevels[strings.TrimSpace(parts[0])] = level
+	}
+	return c
 }
 
 func envOrDefault(convert func(string) interface{}, defaultValue interface{}, envs ...string) interface{} {
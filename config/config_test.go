@@ -62,6 +62,16 @@ func (S) TestLoadConfigDefaultLogBackends(c *check.C) {
 	c.Check(Config.LogBackends, check.DeepEquals, []string{"tsuru", "syslog"})
 }
 
+func (S) TestLoadKeepsConfig(c *check.C) {
+	os.Setenv("LOG_BACKENDS", "syslog")
+	LoadConfig()
+	os.Setenv("LOG_BACKENDS", "gelf")
+	defer os.Unsetenv("LOG_BACKENDS")
+	settings := Load()
+	c.Check(settings.LogBackends, check.DeepEquals, []string{"gelf"})
+	c.Check(Config.LogBackends, check.DeepEquals, []string{"syslog"})
+}
+
 func (S) TestBoolEnvOrDefault(c *check.C) {
 	v := BoolEnvOrDefault(true, "BOOL_ENV")
 	c.Assert(v, check.Equals, true)
@@ -95,3 +105,35 @@ func (S) TestStringsEnvOrDefault(c *check.C) {
 	c.Assert(v, check.DeepEquals, []string{"myvalue", "other", "value", "ok"})
 	c.Assert(buf.String(), check.Equals, "")
 }
+
+func (S) TestLoggingConfig(c *check.C) {
+	os.Setenv("BS_LOG_FORMAT", "json")
+	os.Setenv("BS_LOG_LEVEL", "warn")
+	os.Setenv("BS_LOG_LEVELS", "log forwarder=error, host check=debug,invalid")
+	os.Setenv("BS_LOG_REPEAT_INTERVAL", "5")
+	defer func() {
+		os.Unsetenv("BS_LOG_FORMAT")
+		os.Unsetenv("BS_LOG_LEVEL")
+		os.Unsetenv("BS_LOG_LEVELS")
+		os.Unsetenv("BS_LOG_REPEAT_INTERVAL")
+	}()
+	c.Assert(loggingConfig(), check.DeepEquals, bslog.Config{
+		Format: bslog.JSONFormat,
+		Level:  bslog.WarnLevel,
+		ComponentLevels: map[string]bslog.Level{
+			"log forwarder": bslog.ErrorLevel,
+			"host check":    bslog.DebugLevel,
+		},
+		RepeatInterval: 5 * time.Second,
+	})
+	os.Unsetenv("BS_LOG_FORMAT")
+	os.Unsetenv("BS_LOG_LEVEL")
+	os.Unsetenv("BS_LOG_LEVELS")
+	os.Unsetenv("BS_LOG_REPEAT_INTERVAL")
+	c.Assert(loggingConfig(), check.DeepEquals, bslog.Config{
+		Format:          bslog.TextFormat,
+		Level:           bslog.InfoLevel,
+		ComponentLevels: map[string]bslog.Level{},
+		RepeatInterval:  time.Minute,
+	})
+}
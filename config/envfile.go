@@ -0,0 +1,106 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const envFileVar = "BS_ENV_FILE"
+
+// overrides tracks the variables set in the environment from the config file
+// and the env file, along with their original values, so they can be
+// restored once removed from the files.
+var overrides = struct {
+	sync.Mutex
+	original map[string]*string
+	sources  map[string]string
+}{
+	original: make(map[string]*string),
+	sources:  make(map[string]string),
+}
+
+// applyOverrides sets the variables from the config file, only when not set
+// in the original environment, and the variables from the env file, which
+// override the original environment. Variables set by a previous call and no
+// longer in any of the files are restored.
+func applyOverrides(fileVars, envFileVars map[string]string) {
+	overrides.Lock()
+	defer overrides.Unlock()
+	names := make(map[string]struct{})
+	for name := range overrides.original {
+		names[name] = struct{}{}
+	}
+	for name := range fileVars {
+		names[name] = struct{}{}
+	}
+	for name := range envFileVars {
+		names[name] = struct{}{}
+	}
+	for name := range names {
+		original, managed := overrides.original[name]
+		if !managed {
+			if value, isSet := os.LookupEnv(name); isSet {
+				original = &value
+			}
+		}
+		value := original
+		delete(overrides.sources, name)
+		if fileValue, ok := fileVars[name]; ok && (original == nil || *original == "") {
+			value = &fileValue
+			overrides.sources[name] = sourceConfigFile
+		}
+		if envFileValue, ok := envFileVars[name]; ok {
+			value = &envFileValue
+			overrides.sources[name] = sourceEnvFile
+		}
+		if value == original {
+			delete(overrides.original, name)
+		} else {
+			overrides.original[name] = original
+		}
+		if value == nil {
+			os.Unsetenv(name)
+		} else {
+			os.Setenv(name, *value)
+		}
+	}
+}
+
+// parseEnvFile parses a file with one NAME=VALUE pair per line, blank lines
+// and lines starting with # are ignored.
+func parseEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.Index(line, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid line %d in %s: expected NAME=VALUE", n, path)
+		}
+		name := strings.TrimSpace(line[:idx])
+		if name == envFileVar {
+			continue
+		}
+		value := strings.TrimSpace(line[idx+1:])
+		if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		vars[name] = value
+	}
+	return vars, scanner.Err()
+}
@@ -0,0 +1,54 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (S) TestLoadConfigEnvFile(c *check.C) {
+	dir, err := ioutil.TempDir("", "bs-env-file")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "env")
+	err = ioutil.WriteFile(path, []byte("# bs settings\n\nSTATUS_INTERVAL=30\nMETRICS_INTERVAL = \"15\"\n"), 0600)
+	c.Assert(err, check.IsNil)
+	os.Setenv("STATUS_INTERVAL", "45")
+	os.Unsetenv("METRICS_INTERVAL")
+	os.Setenv("BS_ENV_FILE", path)
+	defer func() {
+		os.Unsetenv("BS_ENV_FILE")
+		LoadConfig()
+	}()
+	LoadConfig()
+	c.Check(Config.StatusInterval, check.Equals, 30*time.Second)
+	c.Check(Config.MetricsInterval, check.Equals, 15*time.Second)
+	err = ioutil.WriteFile(path, []byte("METRICS_INTERVAL=20\n"), 0600)
+	c.Assert(err, check.IsNil)
+	LoadConfig()
+	c.Check(Config.StatusInterval, check.Equals, 45*time.Second)
+	c.Check(Config.MetricsInterval, check.Equals, 20*time.Second)
+	os.Unsetenv("BS_ENV_FILE")
+	LoadConfig()
+	_, isSet := os.LookupEnv("METRICS_INTERVAL")
+	c.Check(isSet, check.Equals, false)
+	c.Check(os.Getenv("STATUS_INTERVAL"), check.Equals, "45")
+}
+
+func (S) TestParseEnvFileInvalidLine(c *check.C) {
+	dir, err := ioutil.TempDir("", "bs-env-file")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "env")
+	err = ioutil.WriteFile(path, []byte("STATUS_INTERVAL=30\ninvalid\n"), 0600)
+	c.Assert(err, check.IsNil)
+	_, err = parseEnvFile(path)
+	c.Assert(err, check.ErrorMatches, `invalid line 2 in .*: expected NAME=VALUE`)
+}
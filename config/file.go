@@ -0,0 +1,258 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/bs/bslog"
+	"gopkg.in/yaml.v1"
+)
+
+const (
+	configFileVar = "BS_CONFIG_FILE"
+
+	sourceDefault    = "default"
+	sourceEnv        = "env"
+	sourceConfigFile = "config file"
+	sourceEnvFile    = "env file"
+	sourceFlag       = "flag"
+)
+
+var files = struct {
+	configFile  string
+	fileVars    map[string]string
+	envFileVars map[string]string
+	errs        []error
+}{}
+
+// SetConfigFile sets the path to the YAML or JSON config file, overriding
+// BS_CONFIG_FILE. LoadConfig must be called for it to take effect.
+func SetConfigFile(path string) {
+	files.configFile = path
+}
+
+func configFilePath() string {
+	if files.configFile != "" {
+		return files.configFile
+	}
+	return os.Getenv(configFileVar)
+}
+
+// loadFiles reads the config file and the env file, setting their variables
+// in the environment. The previous values are kept for files which can't be
+// read.
+func loadFiles() {
+	files.errs = nil
+	fileVars := map[string]string{}
+	if path := configFilePath(); path != "" {
+		var errs []error
+		fileVars, errs = parseConfigFile(path)
+		if fileVars == nil {
+			fileVars = files.fileVars
+		}
+		files.errs = append(files.errs, errs...)
+	}
+	envFileVars := map[string]string{}
+	if path := os.Getenv(envFileVar); path != "" {
+		var err error
+		envFileVars, err = parseEnvFile(path)
+		if err != nil {
+			envFileVars = files.envFileVars
+			files.errs = append(files.errs, fmt.Errorf("unable to load env file: %s", err))
+		}
+	}
+	files.fileVars = fileVars
+	files.envFileVars = envFileVars
+	applyOverrides(fileVars, envFileVars)
+	for _, err := range files.errs {
+		bslog.Errorf("%s", err)
+	}
+}
+
+// parseConfigFile reads the settings in the config file, JSON if the file
+// has the .json extension or YAML otherwise, converting them to the
+// environment variables format. Keys are setting names, case insensitive.
+// The returned map is nil if the file can't be parsed at all, otherwise
+// invalid settings are skipped and reported in the returned errors.
+func parseConfigFile(path string) (map[string]string, []error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, []error{fmt.Errorf("unable to load config file: %s", err)}
+	}
+	raw := map[string]interface{}{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		err = json.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, []error{fmt.Errorf("unable to parse config file %s: %s", path, err)}
+	}
+	var errs []error
+	vars := make(map[string]string, len(raw))
+	for key, value := range raw {
+		name := strings.ToUpper(key)
+		s := lookupSetting(name)
+		if s == nil || s.EnvOnly {
+			errs = append(errs, fmt.Errorf("unknown setting in config file: %s", key))
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		converted, err := s.convert(value)
+		if err == nil {
+			err = s.validate(converted)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config file: %s", err))
+			continue
+		}
+		vars[name] = converted
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	return vars, errs
+}
+
+// convert converts a value parsed from the config file to the environment
+// variable format.
+func (s *setting) convert(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		if s.Type == stringsType {
+			parts := make([]string, len(v))
+			for i := range v {
+				part, err := convertScalar(v[i])
+				if err != nil {
+					return "", fmt.Errorf("invalid %s value for %s: %s", s.Type, s.Name, err)
+				}
+				parts[i] = part
+			}
+			return strings.Join(parts, ","), nil
+		}
+	case map[interface{}]interface{}, map[string]interface{}:
+	default:
+		str, err := convertScalar(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s value for %s: %s", s.Type, s.Name, err)
+		}
+		return str, nil
+	}
+	if s.Type != jsonType {
+		return "", fmt.Errorf("invalid %s value for %s: %v", s.Type, s.Name, value)
+	}
+	data, err := json.Marshal(normalizeYAML(value))
+	if err != nil {
+		return "", fmt.Errorf("invalid %s value for %s: %s", s.Type, s.Name, err)
+	}
+	return string(data), nil
+}
+
+func convertScalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unexpected value %v", value)
+}
+
+// normalizeYAML converts the maps decoded from YAML so they can be encoded
+// as JSON.
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return m
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeYAML(v[i])
+		}
+		return v
+	}
+	return value
+}
+
+// Validate checks the config file and the value of every setting, returning
+// an error describing all invalid settings.
+func Validate() error {
+	errs := append([]error{}, files.errs...)
+	for i := range schema {
+		s := &schema[i]
+		value := os.Getenv(s.Name)
+		if value == "" {
+			continue
+		}
+		if err := s.validate(value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// WriteEffective writes the effective value of every setting, along with
+// where it was set, masking secrets.
+func WriteEffective(w io.Writer) {
+	overrides.Lock()
+	sources := make(map[string]string, len(overrides.sources))
+	for name, source := range overrides.sources {
+		sources[name] = source
+	}
+	overrides.Unlock()
+	for i := range schema {
+		s := &schema[i]
+		value := os.Getenv(s.Name)
+		source := sources[s.Name]
+		if s.Name == configFileVar && files.configFile != "" {
+			value, source = files.configFile, sourceFlag
+		}
+		if value == "" {
+			value, source = s.Default, sourceDefault
+		} else if source == "" {
+			source = sourceEnv
+		}
+		if s.Deprecated != "" {
+			if source == sourceDefault {
+				continue
+			}
+			source += ", deprecated: use " + s.Deprecated
+		}
+		fmt.Fprintf(w, "%s=%s (%s)\n", s.Name, s.mask(value), source)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// settingType is the type of the value of a setting.
+type settingType int
+
+const (
+	stringType settingType = iota
+	boolType
+	intType
+	secondsType
+	stringsType
+	jsonType
+)
+
+const secretMask = "****"
+
+func (t settingType) String() string {
+	switch t {
+	case stringType:
+		return "string"
+	case boolType:
+		return "bool"
+	case intType:
+		return "int"
+	case secondsType:
+		return "seconds"
+	case stringsType:
+		return "strings"
+	case jsonType:
+		return "json"
+	}
+	return "unknown"
+}
+
+// setting describes a configuration setting, named after the environment
+// variable setting it.
+type setting struct {
+	Name       string
+	Type       settingType
+	Default    string
+	Allowed    []string
+	Secret     bool
+	EnvOnly    bool
+	Deprecated string
+}
+
+// schema lists every bs setting.
+var schema = []setting{
+	{Name: "BS_CONFIG_FILE", Type: stringType, EnvOnly: true},
+	{Name: "BS_ENV_FILE", Type: stringType, EnvOnly: true},
+	{Name: "BS_DEBUG", Type: boolType, Default: "false"},
+	{Name: "BS_LOG_FORMAT", Type: stringType, Default: "text", Allowed: []string{"text", "json"}},
+	{Name: "BS_LOG_LEVEL", Type: stringType, Default: "info", Allowed: []string{"debug", "info", "warn", "warning", "error"}},
+	{Name: "BS_LOG_LEVELS", Type: stringsType},
+	{Name: "BS_LOG_REPEAT_INTERVAL", Type: secondsType, Default: "60"},
+	{Name: "DOCKER_ENDPOINT", Type: stringType, Default: DefaultDockerEndpoint},
+	{Name: "TSURU_ENDPOINT", Type: stringType},
+	{Name: "TSURU_TOKEN", Type: stringType, Secret: true},
+	{Name: "SYSLOG_LISTEN_ADDRESS", Type: stringType},
+	{Name: "HOST_PROC", Type: stringType},
+	{Name: "HTTP_LISTEN_ADDRESS", Type: stringType},
+	{Name: "CONTAINER_SELECTION_ENV", Type: stringType},
+	{Name: "CONTAINER_CACHE_WATCH_EVENTS", Type: boolType, Default: "true"},
+	{Name: "STATUS_INTERVAL", Type: secondsType, Default: "60"},
+	{Name: "STATUS_EVENTS_ENABLE", Type: boolType, Default: "true"},
+	{Name: "STATUS_EVENTS_DEBOUNCE", Type: secondsType, Default: "1"},
+	{Name: "STATUS_PAYLOAD_FORMAT", Type: stringType, Default: "auto", Allowed: []string{"auto", "form", "json"}},
+	{Name: "STATUS_ZOMBIE_CYCLES", Type: intType, Default: "3"},
+	{Name: "STATUS_ZOMBIE_MIN_AGE", Type: secondsType, Default: "300"},
+	{Name: "STATUS_ZOMBIE_MAX_REMOVALS", Type: intType, Default: "5"},
+	{Name: "STATUS_ZOMBIE_DRY_RUN", Type: boolType, Default: "false"},
+	{Name: "STATUS_ZOMBIE_ACTION", Type: stringType, Default: "remove", Allowed: []string{"remove", "stop"}},
+	{Name: "METRICS_INTERVAL", Type: secondsType, Default: "60"},
+	{Name: "METRICS_BACKEND", Type: stringType},
+	{Name: "METRICS_ENABLE", Type: boolType, Default: "true"},
+	{Name: "METRICS_ENABLE_BASIC", Type: boolType, Default: "true"},
+	{Name: "METRICS_ENABLE_CONN", Type: boolType, Default: "true"},
+	{Name: "METRICS_ENABLE_HOST", Type: boolType, Default: "true"},
+	{Name: "METRICS_ENABLE_TELEMETRY", Type: boolType, Default: "true"},
+	{Name: "METRICS_NETWORK_INTERFACE", Type: stringType, Default: "eth0"},
+	{Name: "METRICS_LOGSTASH_CLIENT", Type: stringType, Default: "tsuru"},
+	{Name: "METRICS_LOGSTASH_HOST", Type: stringType, Default: "localhost"},
+	{Name: "METRICS_LOGSTASH_PORT", Type: stringType, Default: "1984"},
+	{Name: "METRICS_LOGSTASH_PROTOCOL", Type: stringType, Default: "udp", Allowed: []string{"udp", "tcp"}},
+	{Name: "LOG_BACKENDS", Type: stringsType, Default: "tsuru,syslog", Allowed: []string{"tsuru", "syslog", "gelf", "none"}},
+	{Name: "LOG_BUFFER_SIZE", Type: intType, Deprecated: "LOG_TSURU_BUFFER_SIZE, LOG_SYSLOG_BUFFER_SIZE or LOG_GELF_BUFFER_SIZE"},
+	{Name: "LOG_TSURU_BUFFER_SIZE", Type: intType, Default: strconv.Itoa(DefaultBufferSize)},
+	{Name: "LOG_TSURU_PING_INTERVAL", Type: secondsType, Default: strconv.Itoa(DefaultWsPingInterval)},
+	{Name: "LOG_WS_PING_INTERVAL", Type: secondsType, Deprecated: "LOG_TSURU_PING_INTERVAL"},
+	{Name: "LOG_TSURU_PONG_INTERVAL", Type: secondsType},
+	{Name: "LOG_WS_PONG_INTERVAL", Type: secondsType, Deprecated: "LOG_TSURU_PONG_INTERVAL"},
+	{Name: "LOG_TSURU_CONN_MAX_AGE", Type: secondsType, Default: "-1"},
+	{Name: "LOG_TSURU_DROP_ON_OPEN_CIRCUIT", Type: boolType, Default: "false"},
+	{Name: "LOG_TSURU_ACK_MODE", Type: boolType, Default: "false"},
+	{Name: "LOG_TSURU_ACK_WINDOW", Type: intType, Default: "1000"},
+	{Name: "LOG_TSURU_TRANSPORT", Type: stringType, Default: "websocket", Allowed: []string{"websocket", "http", "auto"}},
+	{Name: "LOG_TSURU_HTTP_BATCH_SIZE", Type: intType, Default: "100"},
+	{Name: "LOG_TSURU_HTTP_BATCH_INTERVAL", Type: secondsType, Default: "1"},
+	{Name: "LOG_TSURU_HTTP_FALLBACK_AFTER", Type: intType, Default: "3"},
+	{Name: "LOG_TSURU_HTTP_RETRY_INTERVAL", Type: secondsType, Default: "60"},
+	{Name: "LOG_TSURU_WORKERS", Type: intType, Default: "1"},
+	{Name: "LOG_SYSLOG_BUFFER_SIZE", Type: intType, Default: strconv.Itoa(DefaultBufferSize)},
+	{Name: "LOG_SYSLOG_FORWARD_ADDRESSES", Type: stringsType},
+	{Name: "SYSLOG_FORWARD_ADDRESSES", Type: stringsType, Deprecated: "LOG_SYSLOG_FORWARD_ADDRESSES"},
+	{Name: "LOG_SYSLOG_TIMEZONE", Type: stringType},
+	{Name: "SYSLOG_TIMEZONE", Type: stringType, Deprecated: "LOG_SYSLOG_TIMEZONE"},
+	{Name: "LOG_SYSLOG_MESSAGE_EXTRA_START", Type: stringType},
+	{Name: "LOG_SYSLOG_MESSAGE_EXTRA_END", Type: stringType},
+	{Name: "LOG_SYSLOG_MTU_NETWORK_INTERFACE", Type: stringType, Default: "eth0"},
+	{Name: "LOG_SYSLOG_CONN_MAX_AGE", Type: secondsType, Default: "-1"},
+	{Name: "LOG_SYSLOG_DROP_ON_OPEN_CIRCUIT", Type: boolType, Default: "false"},
+	{Name: "LOG_SYSLOG_WORKERS", Type: intType, Default: "1"},
+	{Name: "LOG_GELF_HOST", Type: stringType, Default: "localhost:12201"},
+	{Name: "LOG_GELF_CHUNK_SIZE", Type: intType, Default: "1420"},
+	{Name: "LOG_GELF_FIELDS_WHITELIST", Type: stringsType, Default: "request_id,request_time,request_uri,status,method,uri"},
+	{Name: "LOG_GELF_EXTRA_TAGS", Type: jsonType},
+	{Name: "LOG_GELF_BUFFER_SIZE", Type: intType, Default: strconv.Itoa(DefaultBufferSize)},
+	{Name: "LOG_GELF_DROP_ON_OPEN_CIRCUIT", Type: boolType, Default: "false"},
+	{Name: "LOG_GELF_WORKERS", Type: intType, Default: "1"},
+	{Name: "LOG_KUBERNETES_LOG_DIR", Type: stringType, Default: "/var/log/containers"},
+	{Name: "LOG_KUBERNETES_LOG_POS_DIR", Type: stringType, Default: "/var/log/bs"},
+	{Name: "LOG_ROUTING_RULES", Type: jsonType},
+	{Name: "LOG_ROUTING_RULES_FILE", Type: stringType},
+	{Name: "LOG_RATE_LIMIT", Type: intType, Default: "0"},
+	{Name: "LOG_RATE_LIMIT_BURST", Type: intType, Default: "0"},
+	{Name: "LOG_RATE_LIMIT_BY_PROCESS", Type: boolType, Default: "false"},
+	{Name: "LOG_RATE_LIMIT_REPORT_INTERVAL", Type: secondsType, Default: "60"},
+	{Name: "LOG_REDACT_ENABLE", Type: boolType, Default: "false"},
+	{Name: "LOG_REDACT_DETECTORS", Type: stringsType, Default: "creditCard,jwt,authorization,awsKey", Allowed: []string{"creditCard", "jwt", "authorization", "awsKey"}},
+	{Name: "LOG_REDACT_PATTERNS", Type: jsonType},
+	{Name: "LOG_REDACT_MASK", Type: stringType, Default: "[REDACTED]"},
+	{Name: "LOG_METRICS_ENABLE", Type: boolType, Default: "false"},
+	{Name: "LOG_METRICS_EXTRACTORS", Type: jsonType},
+	{Name: "LOG_DEDUP_ENABLE", Type: boolType, Default: "false"},
+	{Name: "LOG_DEDUP_WINDOW", Type: secondsType, Default: "30"},
+	{Name: "LOG_CIRCUIT_BREAKER_THRESHOLD", Type: intType, Default: "5"},
+	{Name: "LOG_RECONNECT_BACKOFF_MIN", Type: secondsType, Default: "0.1"},
+	{Name: "LOG_RECONNECT_BACKOFF_MAX", Type: secondsType, Default: "30"},
+	{Name: "LOG_DRAIN_TIMEOUT", Type: secondsType, Default: "10"},
+	{Name: "HOSTCHECK_TIMEOUT", Type: secondsType, Default: "0"},
+	{Name: "HOSTCHECK_BASE_CONTAINER_NAME", Type: stringType},
+	{Name: "HOSTCHECK_ROOT_PATH_OVERRIDE", Type: stringType, Default: "/"},
+	{Name: "HOSTCHECK_FORCE_ERROR_PATH_OVERRIDE", Type: stringType, Default: "/"},
+	{Name: "HOSTCHECK_CONTAINER_MESSAGE", Type: stringType, Default: "ok"},
+	{Name: "HOSTCHECK_KIND_FILTER", Type: stringsType},
+	{Name: "HOSTCHECK_EXTRA_PATHS", Type: stringsType},
+	{Name: "HOSTCHECK_HISTORY_SIZE", Type: intType, Default: "1"},
+	{Name: "HOSTCHECK_FAILURE_PERCENT", Type: intType, Default: "50"},
+	{Name: "HOSTCHECK_DISK_USAGE_PATHS", Type: stringsType},
+	{Name: "HOSTCHECK_DISK_USAGE_MAX_PERCENT", Type: intType, Default: "90"},
+	{Name: "HOSTCHECK_DISK_USAGE_MIN_FREE_MB", Type: intType, Default: "0"},
+	{Name: "HOSTCHECK_DISK_USAGE_MAX_INODES_PERCENT", Type: intType, Default: "90"},
+	{Name: "HOSTCHECK_DISK_USAGE_MIN_FREE_INODES", Type: intType, Default: "0"},
+	{Name: "HOSTCHECK_DNS_NAMES", Type: stringsType},
+	{Name: "HOSTCHECK_DNS_TIMEOUT", Type: secondsType, Default: "5"},
+	{Name: "HOSTCHECK_TCP_TARGETS", Type: stringsType},
+	{Name: "HOSTCHECK_TCP_TIMEOUT", Type: secondsType, Default: "5"},
+	{Name: "HOSTCHECK_HTTP_TARGETS", Type: stringsType},
+	{Name: "HOSTCHECK_HTTP_TIMEOUT", Type: secondsType, Default: "5"},
+	{Name: "HOSTCHECK_HTTP_EXPECTED_STATUS", Type: intType, Default: "200"},
+	{Name: "HOSTCHECK_SCRIPTS_DIR", Type: stringType},
+	{Name: "HOSTCHECK_SCRIPTS_TIMEOUT", Type: secondsType, Default: "10"},
+	{Name: "HOSTCHECK_SCRIPTS_CONCURRENCY", Type: intType, Default: "2"},
+	{Name: "HOSTCHECK_DOCKER_MAX_LATENCY", Type: secondsType, Default: "0"},
+	{Name: "HOSTCHECK_DOCKER_STORAGE_ENABLE", Type: boolType, Default: "false"},
+	{Name: "HOSTCHECK_DOCKER_STORAGE_DRIVERS", Type: stringsType},
+	{Name: "HOSTCHECK_DOCKER_STORAGE_MIN_FREE_PERCENT", Type: intType, Default: "10"},
+	{Name: "HOSTCHECK_PULL_IMAGE", Type: stringType},
+	{Name: "HOSTCHECK_PULL_TIMEOUT", Type: secondsType, Default: "60"},
+	{Name: "HOSTCHECK_PULL_USERNAME", Type: stringType},
+	{Name: "HOSTCHECK_PULL_PASSWORD", Type: stringType, Secret: true},
+}
+
+func lookupSetting(name string) *setting {
+	for i := range schema {
+		if schema[i].Name == name {
+			return &schema[i]
+		}
+	}
+	return nil
+}
+
+// validate checks whether value, in the environment variable format, is
+// valid for the setting.
+func (s *setting) validate(value string) error {
+	var err error
+	switch s.Type {
+	case boolType:
+		_, err = strconv.ParseBool(value)
+	case intType:
+		_, err = strconv.Atoi(value)
+	case secondsType:
+		_, err = strconv.ParseFloat(value, 64)
+	case jsonType:
+		if !json.Valid([]byte(value)) {
+			err = fmt.Errorf("invalid JSON")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s value for %s: %q", s.Type, s.Name, value)
+	}
+	if len(s.Allowed) == 0 {
+		return nil
+	}
+	values := []string{value}
+	if s.Type == stringsType {
+		values = strings.Split(value, ",")
+	}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		var allowed bool
+		for _, a := range s.Allowed {
+			if v == a {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("invalid value for %s: %q, expected one of %s", s.Name, v, strings.Join(s.Allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// mask hides the value of secret settings and passwords in URLs.
+func (s *setting) mask(value string) string {
+	if value == "" {
+		return value
+	}
+	if s.Secret {
+		return secretMask
+	}
+	if s.Type != stringType && s.Type != stringsType {
+		return value
+	}
+	parts := strings.Split(value, ",")
+	for i, part := range parts {
+		u, err := url.Parse(strings.TrimSpace(part))
+		if err != nil || u.User == nil {
+			continue
+		}
+		if _, hasPassword := u.User.Password(); hasPassword {
+			parts[i] = u.Redacted()
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -9,12 +9,15 @@ import (
 	"errors"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/tsuru/bs/bslog"
 	"github.com/tsuru/bs/config"
+	"github.com/tsuru/bs/telemetry"
 )
 
 var (
@@ -30,10 +33,24 @@ var (
 
 const containerIDTrimSize = 12
 
+var (
+	cacheHits   = telemetry.NewCounter("bs_container_cache_hits")
+	cacheMisses = telemetry.NewCounter("bs_container_cache_misses")
+	inspectErrs = telemetry.NewCounter("bs_container_inspect_errors")
+)
+
 type InfoClient struct {
+	hits   uint64
+	misses uint64
+
 	endpoint       string
 	client         *docker.Client
+	cacheMu        sync.RWMutex
 	containerCache *lru.Cache
+	cacheCapacity  int
+	running        int
+	watcher        *eventsWatcher
+	handlers       []func(*docker.APIEvents)
 
 	extra        json.RawMessage
 	decodedExtra map[string]string
@@ -58,7 +75,8 @@ const (
 func NewClient(endpoint string) (*InfoClient, error) {
 	c := InfoClient{endpoint: endpoint}
 	var err error
-	c.containerCache, err = lru.New(100)
+	c.cacheCapacity = defaultCacheSize
+	c.containerCache, err = lru.New(c.cacheCapacity)
 	if err != nil {
 		return nil, err
 	}
@@ -103,13 +121,18 @@ func (c *InfoClient) GetAppContainer(containerId string, useCache bool) (*Contai
 
 func (c *InfoClient) getContainer(containerId string, useCache bool) (*Container, error) {
 	if useCache {
-		if val, ok := c.containerCache.Get(containerId); ok {
+		if val, ok := c.cache().Get(containerId); ok {
+			atomic.AddUint64(&c.hits, 1)
+			cacheHits.Inc()
 			return val.(*Container), nil
 		}
+		atomic.AddUint64(&c.misses, 1)
+		cacheMisses.Inc()
 	}
 
 	cont, err := c.client.InspectContainer(containerId)
 	if err != nil {
+		inspectErrs.Inc()
 		return nil, err
 	}
 
@@ -152,7 +175,7 @@ func (c *InfoClient) getContainer(containerId string, useCache bool) (*Container
 		contData.ShortHostname = contData.Config.Hostname[:containerIDTrimSize]
 	}
 
-	c.containerCache.Add(containerId, &contData)
+	c.addToCache(containerId, &contData)
 	return &contData, nil
 }
 
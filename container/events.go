@@ -0,0 +1,306 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/tsuru/bs/bslog"
+	"github.com/tsuru/bs/telemetry"
+)
+
+// defaultCacheSize is the minimum capacity of the container cache, which
+// grows to twice the number of running containers while events are watched.
+const defaultCacheSize = 100
+
+var eventsRetryInterval = 5 * time.Second
+
+// runningResyncInterval is the interval in which running containers are
+// listed again, correcting the count kept from start and die events.
+var runningResyncInterval = time.Minute
+
+var (
+	cacheInvalidations = telemetry.NewCounter("bs_container_cache_invalidations")
+	eventsReceived     = telemetry.NewCounter("bs_container_events")
+)
+
+// CacheStats holds the state of the container cache of an InfoClient.
+type CacheStats struct {
+	Size          int    `json:"size"`
+	Capacity      int    `json:"capacity"`
+	Running       int    `json:"running"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	WatchesEvents bool   `json:"watchesEvents"`
+}
+
+type eventsWatcher struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (c *InfoClient) cache() *lru.Cache {
+	c.cacheMu.RLock()
+	defer c.cacheMu.RUnlock()
+	return c.containerCache
+}
+
+// addToCache adds the container to the cache holding the read lock, so the
+// entry isn't lost if the cache is replaced by setRunning meanwhile.
+func (c *InfoClient) addToCache(key string, cont *Container) {
+	c.cacheMu.RLock()
+	defer c.cacheMu.RUnlock()
+	c.containerCache.Add(key, cont)
+}
+
+// CacheStats returns the size and the hit and miss counts of the container
+// cache.
+func (c *InfoClient) CacheStats() CacheStats {
+	c.cacheMu.RLock()
+	defer c.cacheMu.RUnlock()
+	return CacheStats{
+		Size:          c.containerCache.Len(),
+		Capacity:      c.cacheCapacity,
+		Running:       c.running,
+		Hits:          atomic.LoadUint64(&c.hits),
+		Misses:        atomic.LoadUint64(&c.misses),
+		WatchesEvents: c.watcher != nil,
+	}
+}
+
+// WatchEvents subscribes to Docker events, keeping the container cache fresh:
+// cached containers are removed when created or destroyed and inspected again
+// when renamed or updated. The cache capacity follows the number of running
+// containers, which is listed again every minute. The subscription is retried whenever the events stream ends,
+// the cache being purged as events may have been lost meanwhile.
+func (c *InfoClient) WatchEvents() error {
+	eventsURL, err := c.eventsURL()
+	if err != nil {
+		return err
+	}
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	if c.watcher != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &eventsWatcher{cancel: cancel, done: make(chan struct{})}
+	c.watcher = w
+	go c.watchEvents(ctx, w, eventsURL)
+	return nil
+}
+
+// OnEvent registers a function called with every container event received
+// while watching events, after the cache is updated. It must not block.
+func (c *InfoClient) OnEvent(handler func(*docker.APIEvents)) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	c.handlers = append(c.handlers, handler)
+}
+
+// StopWatchingEvents stops the subscription started by WatchEvents.
+func (c *InfoClient) StopWatchingEvents() {
+	c.cacheMu.Lock()
+	w := c.watcher
+	c.watcher = nil
+	c.cacheMu.Unlock()
+	if w != nil {
+		w.cancel()
+		<-w.done
+	}
+}
+
+// eventsURL returns the URL of the container events stream, using the same
+// transport of the docker client, which dials the socket for unix endpoints.
+func (c *InfoClient) eventsURL() (string, error) {
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return "", err
+	}
+	host := u.Host
+	if u.Scheme == "unix" {
+		host = "unix.sock"
+	}
+	scheme := "http"
+	if c.client.TLSConfig != nil || u.Scheme == "https" {
+		scheme = "https"
+	}
+	filters := url.Values{"filters": []string{`{"type":["container"]}`}}
+	return fmt.Sprintf("%s://%s/events?%s", scheme, host, filters.Encode()), nil
+}
+
+func (c *InfoClient) watchEvents(ctx context.Context, w *eventsWatcher, eventsURL string) {
+	defer close(w.done)
+	resyncDone := make(chan struct{})
+	go c.resyncRunning(ctx, resyncDone)
+	defer func() { <-resyncDone }()
+	for {
+		if err := c.resizeCache(); err != nil {
+			bslog.Warnf("[container cache] unable to list running containers: %s", err)
+		}
+		err := c.streamEvents(ctx, eventsURL)
+		if ctx.Err() != nil {
+			return
+		}
+		bslog.Errorf("[container cache] docker events stream interrupted, purging container cache: %s", err)
+		c.cache().Purge()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsRetryInterval):
+		}
+	}
+}
+
+// resyncRunning lists the running containers every runningResyncInterval
+// until ctx is canceled, as events may be missed or arrive out of order.
+func (c *InfoClient) resyncRunning(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	t := time.NewTicker(runningResyncInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := c.resizeCache(); err != nil {
+				bslog.Warnf("[container cache] unable to list running containers: %s", err)
+			}
+		}
+	}
+}
+
+// streamEvents handles the events received from Docker until the stream is
+// interrupted or ctx is canceled.
+func (c *InfoClient) streamEvents(ctx context.Context, eventsURL string) error {
+	req, err := http.NewRequest(http.MethodGet, eventsURL, nil)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Transport: c.client.HTTPClient.Transport}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var ev docker.APIEvents
+		if err := decoder.Decode(&ev); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		eventsReceived.Inc()
+		c.handleEvent(&ev)
+		c.cacheMu.RLock()
+		handlers := c.handlers
+		c.cacheMu.RUnlock()
+		for _, handler := range handlers {
+			handler(&ev)
+		}
+	}
+}
+
+func (c *InfoClient) handleEvent(ev *docker.APIEvents) {
+	if ev.Type != "" && ev.Type != "container" {
+		return
+	}
+	id, action := ev.Actor.ID, ev.Action
+	if id == "" {
+		id = ev.ID
+	}
+	if action == "" {
+		action = ev.Status
+	}
+	switch action {
+	case "create", "destroy":
+		c.invalidate(id)
+	case "rename", "update":
+		for _, key := range c.invalidate(id) {
+			if _, err := c.getContainer(key, false); err != nil {
+				bslog.Debugf("[container cache] unable to refresh container %s: %s", key, err)
+			}
+		}
+	case "start":
+		c.setRunning(func(n int) int { return n + 1 })
+	case "die":
+		c.setRunning(func(n int) int { return n - 1 })
+	}
+}
+
+// invalidate removes the container from the cache, returning the removed
+// keys. Keys may be the full container ID or a prefix of it, as in the short
+// IDs used in log tags.
+func (c *InfoClient) invalidate(id string) []string {
+	if id == "" {
+		return nil
+	}
+	c.cacheMu.RLock()
+	defer c.cacheMu.RUnlock()
+	var removed []string
+	for _, key := range c.containerCache.Keys() {
+		k, ok := key.(string)
+		if !ok || k == "" || !strings.HasPrefix(id, k) {
+			continue
+		}
+		c.containerCache.Remove(key)
+		cacheInvalidations.Inc()
+		removed = append(removed, k)
+	}
+	return removed
+}
+
+func (c *InfoClient) resizeCache() error {
+	containers, err := c.ListContainers()
+	if err != nil {
+		return err
+	}
+	c.setRunning(func(int) int { return len(containers) })
+	return nil
+}
+
+// setRunning updates the number of running containers, resizing the cache
+// accordingly and keeping the most recently used entries.
+func (c *InfoClient) setRunning(update func(int) int) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	c.running = update(c.running)
+	if c.running < 0 {
+		c.running = 0
+	}
+	capacity := 2 * c.running
+	if capacity < defaultCacheSize {
+		capacity = defaultCacheSize
+	}
+	if capacity == c.cacheCapacity {
+		return
+	}
+	cache, err := lru.New(capacity)
+	if err != nil {
+		return
+	}
+	for _, key := range c.containerCache.Keys() {
+		if value, ok := c.containerCache.Peek(key); ok {
+			cache.Add(key, value)
+		}
+	}
+	c.containerCache = cache
+	c.cacheCapacity = capacity
+}
@@ -0,0 +1,177 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	dTesting "github.com/fsouza/go-dockerclient/testing"
+	"gopkg.in/check.v1"
+)
+
+func (S) TestInfoClientHandleEventInvalidates(c *check.C) {
+	dockerServer, err := dTesting.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer dockerServer.Stop()
+	id := createContainer(c, dockerServer.URL(), []string{"TSURU_APPNAME=coolappname"}, nil, "myContName")
+	client, err := NewClient(dockerServer.URL())
+	c.Assert(err, check.IsNil)
+	cont, err := client.GetContainer(id, true, nil)
+	c.Assert(err, check.IsNil)
+	client.containerCache.Add(id[:containerIDTrimSize], cont)
+	c.Assert(client.containerCache.Len(), check.Equals, 2)
+	client.handleEvent(&docker.APIEvents{Type: "container", Action: "destroy", Actor: docker.APIActor{ID: "other"}})
+	client.handleEvent(&docker.APIEvents{Type: "image", Action: "destroy", Actor: docker.APIActor{ID: id}})
+	c.Assert(client.containerCache.Len(), check.Equals, 2)
+	client.handleEvent(&docker.APIEvents{Status: "destroy", ID: id})
+	c.Assert(client.containerCache.Len(), check.Equals, 0)
+}
+
+func (S) TestInfoClientHandleEventRefreshes(c *check.C) {
+	dockerCalls := 0
+	dockerServer, err := dTesting.NewServer("127.0.0.1:0", nil, func(req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/json") {
+			dockerCalls++
+		}
+	})
+	c.Assert(err, check.IsNil)
+	defer dockerServer.Stop()
+	id := createContainer(c, dockerServer.URL(), nil, nil, "oldname")
+	client, err := NewClient(dockerServer.URL())
+	c.Assert(err, check.IsNil)
+	cont, err := client.GetContainer(id, true, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(cont.AppName, check.Equals, "oldname")
+	err = client.client.RenameContainer(docker.RenameContainerOptions{ID: id, Name: "newname"})
+	c.Assert(err, check.IsNil)
+	client.handleEvent(&docker.APIEvents{Type: "container", Action: "rename", Actor: docker.APIActor{ID: id}})
+	c.Assert(dockerCalls, check.Equals, 2)
+	cont, err = client.GetContainer(id, true, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(cont.AppName, check.Equals, "newname")
+	c.Assert(dockerCalls, check.Equals, 2)
+	client.handleEvent(&docker.APIEvents{Type: "container", Action: "update", Actor: docker.APIActor{ID: "notcached"}})
+	c.Assert(dockerCalls, check.Equals, 2)
+	stats := client.CacheStats()
+	c.Assert(stats.Hits, check.Equals, uint64(1))
+	c.Assert(stats.Misses, check.Equals, uint64(1))
+	c.Assert(stats.Size, check.Equals, 1)
+}
+
+func (S) TestInfoClientCacheFollowsRunningContainers(c *check.C) {
+	dockerServer, err := dTesting.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer dockerServer.Stop()
+	id := createContainer(c, dockerServer.URL(), nil, nil, "cont")
+	client, err := NewClient(dockerServer.URL())
+	c.Assert(err, check.IsNil)
+	_, err = client.GetContainer(id, true, nil)
+	c.Assert(err, check.IsNil)
+	for i := 0; i < 60; i++ {
+		client.handleEvent(&docker.APIEvents{Type: "container", Action: "start"})
+	}
+	stats := client.CacheStats()
+	c.Assert(stats.Running, check.Equals, 60)
+	c.Assert(stats.Capacity, check.Equals, 120)
+	c.Assert(stats.Size, check.Equals, 1)
+	for i := 0; i < 70; i++ {
+		client.handleEvent(&docker.APIEvents{Type: "container", Action: "die"})
+	}
+	stats = client.CacheStats()
+	c.Assert(stats.Running, check.Equals, 0)
+	c.Assert(stats.Capacity, check.Equals, defaultCacheSize)
+	c.Assert(stats.Size, check.Equals, 1)
+}
+
+func (S) TestInfoClientResyncRunning(c *check.C) {
+	dockerServer, err := dTesting.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer dockerServer.Stop()
+	id := createContainer(c, dockerServer.URL(), nil, nil, "cont")
+	client, err := NewClient(dockerServer.URL())
+	c.Assert(err, check.IsNil)
+	c.Assert(client.client.StartContainer(id, nil), check.IsNil)
+	for i := 0; i < 3; i++ {
+		client.handleEvent(&docker.APIEvents{Type: "container", Action: "start"})
+	}
+	c.Assert(client.CacheStats().Running, check.Equals, 3)
+	defer func(interval time.Duration) { runningResyncInterval = interval }(runningResyncInterval)
+	runningResyncInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go client.resyncRunning(ctx, done)
+	timeout := time.After(5 * time.Second)
+	for client.CacheStats().Running != 1 {
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for running containers to be listed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+}
+
+func (S) TestInfoClientWatchEvents(c *check.C) {
+	dockerServer, err := dTesting.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer dockerServer.Stop()
+	id := createContainer(c, dockerServer.URL(), nil, nil, "cont")
+	events := make(chan docker.APIEvents)
+	dockerServer.CustomHandler("/events", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query().Get("filters"), check.Equals, `{"type":["container"]}`)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		encoder := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev := <-events:
+				encoder.Encode(ev)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	client, err := NewClient(dockerServer.URL())
+	c.Assert(err, check.IsNil)
+	_, err = client.GetContainer(id, true, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(client.CacheStats().WatchesEvents, check.Equals, false)
+	err = client.WatchEvents()
+	c.Assert(err, check.IsNil)
+	c.Assert(client.WatchEvents(), check.IsNil)
+	c.Assert(client.CacheStats().WatchesEvents, check.Equals, true)
+	events <- docker.APIEvents{Type: "container", Action: "destroy", Actor: docker.APIActor{ID: id}, Time: time.Now().Unix()}
+	timeout := time.After(5 * time.Second)
+	for client.CacheStats().Size != 0 {
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for the container to be removed from the cache")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	client.StopWatchingEvents()
+	c.Assert(client.CacheStats().WatchesEvents, check.Equals, false)
+	client.StopWatchingEvents()
+}
+
+func (S) TestInfoClientEventsURL(c *check.C) {
+	client, err := NewClient("unix:///var/run/docker.sock")
+	c.Assert(err, check.IsNil)
+	eventsURL, err := client.eventsURL()
+	c.Assert(err, check.IsNil)
+	c.Assert(eventsURL, check.Equals, "http://unix.sock/events?filters=%7B%22type%22%3A%5B%22container%22%5D%7D")
+	client, err = NewClient("tcp://127.0.0.1:2375")
+	c.Assert(err, check.IsNil)
+	eventsURL, err = client.eventsURL()
+	c.Assert(err, check.IsNil)
+	c.Assert(eventsURL, check.Equals, "http://127.0.0.1:2375/events?filters=%7B%22type%22%3A%5B%22container%22%5D%7D")
+}
@@ -0,0 +1,163 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsuru/bs/bslog"
+	"github.com/tsuru/bs/config"
+)
+
+type circuitState int32
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+var circuits = struct {
+	sync.Mutex
+	m map[string]*circuitBreaker
+}{m: make(map[string]*circuitBreaker)}
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitClosed:
+		return "closed"
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// circuitBreaker tracks consecutive failures of a forwarder, computing a
+// jittered exponential backoff between reconnection attempts. After threshold
+// failures the circuit opens, each new connection attempt after that is a
+// half-open probe closing the circuit if successful.
+type circuitBreaker struct {
+	mu         sync.Mutex
+	name       string
+	state      circuitState
+	failures   int32
+	threshold  int
+	backoffMin time.Duration
+	backoffMax time.Duration
+	lastErr    error
+}
+
+func circuitFor(name string) *circuitBreaker {
+	circuits.Lock()
+	defer circuits.Unlock()
+	return circuits.m[name]
+}
+
+func newCircuitBreaker(name string) *circuitBreaker {
+	return &circuitBreaker{
+		name:       name,
+		threshold:  config.IntEnvOrDefault(5, "LOG_CIRCUIT_BREAKER_THRESHOLD"),
+		backoffMin: config.SecondsEnvOrDefault(0.1, "LOG_RECONNECT_BACKOFF_MIN"),
+		backoffMax: config.SecondsEnvOrDefault(30, "LOG_RECONNECT_BACKOFF_MAX"),
+	}
+}
+
+func (b *circuitBreaker) register() {
+	circuits.Lock()
+	defer circuits.Unlock()
+	circuits.m[b.name] = b
+}
+
+func (b *circuitBreaker) unregister() {
+	circuits.Lock()
+	defer circuits.Unlock()
+	if circuits.m[b.name] == b {
+		delete(circuits.m, b.name)
+	}
+}
+
+func (b *circuitBreaker) State() circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// snapshot returns the current state, the number of consecutive failures
+// and the last failure of the circuit.
+func (b *circuitBreaker) snapshot() (circuitState, int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state, int(atomic.LoadInt32(&b.failures)), b.lastErr
+}
+
+// attempt must be called before each connection attempt.
+func (b *circuitBreaker) attempt() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitOpen {
+		b.state = circuitHalfOpen
+	}
+}
+
+// connected must be called after a successful connection.
+func (b *circuitBreaker) connected() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != circuitClosed {
+		bslog.Warnf("[log forwarder] circuit closed for %s", b.name)
+		b.state = circuitClosed
+	}
+}
+
+// delivered must be called after a message is successfully processed, only
+// then the backoff is reset.
+func (b *circuitBreaker) delivered() {
+	if atomic.LoadInt32(&b.failures) == 0 {
+		return
+	}
+	atomic.StoreInt32(&b.failures, 0)
+}
+
+// failure accounts a connection or write failure returning how long to wait
+// before trying to reconnect.
+func (b *circuitBreaker) failure(err error) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	failures := atomic.AddInt32(&b.failures, 1)
+	b.lastErr = err
+	if b.state != circuitOpen && int(failures) >= b.threshold {
+		bslog.Errorf("[log forwarder] circuit open for %s after %d failures: %s", b.name, failures, err)
+		b.state = circuitOpen
+	}
+	return b.backoff(int(failures))
+}
+
+func (b *circuitBreaker) backoff(failures int) time.Duration {
+	delay := b.backoffMin
+	for i := 1; i < failures && delay < b.backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > b.backoffMax {
+		delay = b.backoffMax
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+func forwarderName(forwarder forwarderBackend) string {
+	if s, ok := forwarder.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", forwarder)
+}
@@ -0,0 +1,92 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/tsuru/bs/telemetry"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestCircuitBreakerBackoff(c *check.C) {
+	os.Setenv("LOG_RECONNECT_BACKOFF_MIN", "1")
+	os.Setenv("LOG_RECONNECT_BACKOFF_MAX", "8")
+	defer os.Unsetenv("LOG_RECONNECT_BACKOFF_MIN")
+	defer os.Unsetenv("LOG_RECONNECT_BACKOFF_MAX")
+	b := newCircuitBreaker("test")
+	tests := []struct {
+		failures int
+		max      time.Duration
+	}{
+		{failures: 1, max: time.Second},
+		{failures: 2, max: 2 * time.Second},
+		{failures: 3, max: 4 * time.Second},
+		{failures: 4, max: 8 * time.Second},
+		{failures: 10, max: 8 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			d := b.backoff(tt.failures)
+			c.Check(d >= tt.max/2, check.Equals, true, check.Commentf("failures %d: %v", tt.failures, d))
+			c.Check(d <= tt.max, check.Equals, true, check.Commentf("failures %d: %v", tt.failures, d))
+		}
+	}
+}
+
+func (s *S) TestCircuitBreakerStates(c *check.C) {
+	os.Setenv("LOG_CIRCUIT_BREAKER_THRESHOLD", "2")
+	defer os.Unsetenv("LOG_CIRCUIT_BREAKER_THRESHOLD")
+	b := newCircuitBreaker("syslog udp://localhost:1514")
+	b.register()
+	defer b.unregister()
+	c.Assert(circuitFor("syslog udp://localhost:1514"), check.Equals, b)
+	c.Assert(b.State().String(), check.Equals, "closed")
+	errConn := errors.New("connection refused")
+	b.failure(errConn)
+	c.Assert(b.State(), check.Equals, circuitClosed)
+	b.failure(errConn)
+	c.Assert(b.State(), check.Equals, circuitOpen)
+	c.Assert(b.State().String(), check.Equals, "open")
+	b.attempt()
+	c.Assert(b.State(), check.Equals, circuitHalfOpen)
+	b.failure(errConn)
+	c.Assert(b.State(), check.Equals, circuitOpen)
+	b.attempt()
+	b.connected()
+	c.Assert(b.State(), check.Equals, circuitClosed)
+	c.Assert(b.failures, check.Equals, int32(3))
+	b.delivered()
+	c.Assert(b.failures, check.Equals, int32(0))
+	b.unregister()
+	c.Assert(circuitFor("syslog udp://localhost:1514"), check.IsNil)
+}
+
+func (s *S) TestWaitReconnectDropsOnOpenCircuit(c *check.C) {
+	os.Setenv("LOG_CIRCUIT_BREAKER_THRESHOLD", "1")
+	defer os.Unsetenv("LOG_CIRCUIT_BREAKER_THRESHOLD")
+	b := newCircuitBreaker("test")
+	b.failure(errors.New("fail"))
+	ch := make(chan LogMessage, 3)
+	ch <- "a"
+	ch <- "b"
+	var shardDropped uint64
+	stats := &forwarderTelemetry{
+		backendTelemetry: &backendTelemetry{dropped: telemetry.NewCounter("bs_log_test_open_circuit_dropped")},
+		shardDropped:     &shardDropped,
+	}
+	c.Assert(waitReconnect(10*time.Millisecond, b, false, ch, nil, stats), check.Equals, true)
+	c.Assert(ch, check.HasLen, 2)
+	c.Assert(stats.dropped.Value(), check.Equals, uint64(0))
+	c.Assert(waitReconnect(10*time.Millisecond, b, true, ch, nil, stats), check.Equals, true)
+	c.Assert(ch, check.HasLen, 0)
+	c.Assert(stats.dropped.Value(), check.Equals, uint64(2))
+	c.Assert(shardDropped, check.Equals, uint64(2))
+	quit := make(chan bool)
+	close(quit)
+	c.Assert(waitReconnect(time.Minute, b, true, ch, quit, stats), check.Equals, false)
+}
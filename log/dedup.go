@@ -0,0 +1,184 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tsuru/bs/config"
+	"github.com/tsuru/bs/container"
+)
+
+const dedupLabel = "bs.tsuru.io/log-dedup"
+
+type dedupEntry struct {
+	containerID string
+	container   *container.Container
+	content     []byte
+	priority    []byte
+	lastTs      time.Time
+	first       time.Time
+	count       int
+	window      time.Duration
+	timer       *time.Timer
+}
+
+// logDeduplicator collapses identical consecutive messages from the same
+// container, within a time window, into the first message followed by a
+// "last message repeated N times" entry, similar to what syslogd does.
+type logDeduplicator struct {
+	mu      sync.Mutex
+	enabled bool
+	window  time.Duration
+	entries map[string]*dedupEntry
+	send    func(*rawLogParts, *container.Container)
+	now     func() time.Time
+}
+
+func newLogDeduplicator(send func(*rawLogParts, *container.Container)) *logDeduplicator {
+	return &logDeduplicator{
+		enabled: config.BoolEnvOrDefault(false, "LOG_DEDUP_ENABLE"),
+		window:  config.SecondsEnvOrDefault(30, "LOG_DEDUP_WINDOW"),
+		entries: make(map[string]*dedupEntry),
+		send:    send,
+		now:     time.Now,
+	}
+}
+
+// windowFor returns the deduplication window for the container, the
+// bs.tsuru.io/log-dedup label may enable, disable or set a custom window (in
+// seconds) for it.
+func (d *logDeduplicator) windowFor(c *container.Container) time.Duration {
+	val, ok := c.GetLabelAny(dedupLabel)
+	if !ok {
+		if d.enabled {
+			return d.window
+		}
+		return 0
+	}
+	if enabled, err := strconv.ParseBool(val); err == nil {
+		if enabled {
+			return d.window
+		}
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(val, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return 0
+}
+
+// filter reports whether the entry must be forwarded, i.e. it's not a repeat
+// of the previous message from the same container. Pending repetition
+// reports are sent without holding the lock, before the entry is forwarded.
+func (d *logDeduplicator) filter(parts *rawLogParts, c *container.Container) bool {
+	if d == nil {
+		return true
+	}
+	window := d.windowFor(c)
+	if window <= 0 {
+		return true
+	}
+	now := d.now()
+	id := string(parts.container)
+	d.mu.Lock()
+	e := d.entries[id]
+	if e != nil && now.Sub(e.first) < window && bytes.Equal(e.content, parts.content) {
+		e.count++
+		e.lastTs = parts.ts
+		d.mu.Unlock()
+		return false
+	}
+	var report *dedupReport
+	if e == nil {
+		e = &dedupEntry{containerID: id}
+		e.timer = time.AfterFunc(window, func() {
+			d.expire(e)
+		})
+		d.entries[id] = e
+	} else {
+		report = e.report()
+		e.timer.Reset(window)
+	}
+	e.container = c
+	e.content = append(e.content[:0], parts.content...)
+	e.priority = append(e.priority[:0], parts.priority...)
+	e.lastTs = parts.ts
+	e.first = now
+	e.window = window
+	d.mu.Unlock()
+	d.sendReport(report)
+	return true
+}
+
+// expire removes the entry once its window is over. The window is checked
+// again, as the entry may have been reset by a new message after the timer
+// fired, in which case the timer fires again later.
+func (d *logDeduplicator) expire(e *dedupEntry) {
+	d.mu.Lock()
+	if d.entries[e.containerID] != e || d.now().Sub(e.first) < e.window {
+		d.mu.Unlock()
+		return
+	}
+	report := e.report()
+	delete(d.entries, e.containerID)
+	d.mu.Unlock()
+	d.sendReport(report)
+}
+
+// dedupReport is a "last message repeated N times" entry to be sent.
+type dedupReport struct {
+	parts     *rawLogParts
+	container *container.Container
+}
+
+// report returns the repetition report of the entry, if any, resetting its
+// count. It must be called holding the lock.
+func (e *dedupEntry) report() *dedupReport {
+	if e.count == 0 {
+		return nil
+	}
+	r := &dedupReport{
+		parts: &rawLogParts{
+			ts:        e.lastTs,
+			priority:  append([]byte(nil), e.priority...),
+			container: []byte(e.containerID),
+			content:   []byte(fmt.Sprintf("last message repeated %d times", e.count)),
+		},
+		container: e.container,
+	}
+	e.count = 0
+	return r
+}
+
+func (d *logDeduplicator) sendReport(r *dedupReport) {
+	if r != nil {
+		d.send(r.parts, r.container)
+	}
+}
+
+// flush sends pending repetition reports for every container.
+func (d *logDeduplicator) flush() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	var reports []*dedupReport
+	for id, e := range d.entries {
+		e.timer.Stop()
+		if r := e.report(); r != nil {
+			reports = append(reports, r)
+		}
+		delete(d.entries, id)
+	}
+	d.mu.Unlock()
+	for _, r := range reports {
+		d.sendReport(r)
+	}
+}
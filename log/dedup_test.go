@@ -0,0 +1,155 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tsuru/bs/container"
+	"gopkg.in/check.v1"
+)
+
+type sentParts struct {
+	mu    sync.Mutex
+	parts []*rawLogParts
+}
+
+func (s *sentParts) send(parts *rawLogParts, c *container.Container) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parts = append(s.parts, parts)
+}
+
+func (s *sentParts) contents() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var contents []string
+	for _, p := range s.parts {
+		contents = append(contents, string(p.content))
+	}
+	return contents
+}
+
+func (s *S) TestLogDeduplicatorFilter(c *check.C) {
+	os.Setenv("LOG_DEDUP_ENABLE", "true")
+	defer os.Unsetenv("LOG_DEDUP_ENABLE")
+	var sent sentParts
+	d := newLogDeduplicator(sent.send)
+	defer d.flush()
+	cont := routingContainer("myapp", "web", nil)
+	msg := func(content string) *rawLogParts {
+		return &rawLogParts{priority: []byte("27"), content: []byte(content), container: []byte("cont1")}
+	}
+	c.Assert(d.filter(msg("crashed"), cont), check.Equals, true)
+	c.Assert(d.filter(msg("crashed"), cont), check.Equals, false)
+	c.Assert(d.filter(msg("crashed"), cont), check.Equals, false)
+	c.Assert(d.filter(&rawLogParts{content: []byte("crashed"), container: []byte("cont2")}, cont), check.Equals, true)
+	c.Assert(sent.contents(), check.HasLen, 0)
+	c.Assert(d.filter(msg("starting"), cont), check.Equals, true)
+	c.Assert(sent.contents(), check.DeepEquals, []string{"last message repeated 2 times"})
+	c.Assert(string(sent.parts[0].priority), check.Equals, "27")
+	c.Assert(string(sent.parts[0].container), check.Equals, "cont1")
+	c.Assert(d.filter(msg("crashed"), cont), check.Equals, true)
+	c.Assert(sent.contents(), check.HasLen, 1)
+}
+
+func (s *S) TestLogDeduplicatorWindowExpired(c *check.C) {
+	os.Setenv("LOG_DEDUP_ENABLE", "true")
+	os.Setenv("LOG_DEDUP_WINDOW", "0.1")
+	defer os.Unsetenv("LOG_DEDUP_ENABLE")
+	defer os.Unsetenv("LOG_DEDUP_WINDOW")
+	var sent sentParts
+	d := newLogDeduplicator(sent.send)
+	cont := routingContainer("myapp", "web", nil)
+	msg := &rawLogParts{content: []byte("crashed"), container: []byte("cont1")}
+	c.Assert(d.filter(msg, cont), check.Equals, true)
+	c.Assert(d.filter(msg, cont), check.Equals, false)
+	timeout := time.After(5 * time.Second)
+	for len(sent.contents()) == 0 {
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for repeated message report")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	c.Assert(sent.contents(), check.DeepEquals, []string{"last message repeated 1 times"})
+	c.Assert(d.filter(msg, cont), check.Equals, true)
+	d.flush()
+	c.Assert(d.entries, check.HasLen, 0)
+}
+
+func (s *S) TestLogDeduplicatorLabel(c *check.C) {
+	var sent sentParts
+	d := newLogDeduplicator(sent.send)
+	defer d.flush()
+	msg := &rawLogParts{content: []byte("crashed"), container: []byte("cont1")}
+	disabled := routingContainer("myapp", "web", nil)
+	c.Assert(d.filter(msg, disabled), check.Equals, true)
+	c.Assert(d.filter(msg, disabled), check.Equals, true)
+	c.Assert(d.windowFor(routingContainer("myapp", "web", map[string]string{dedupLabel: "true"})), check.Equals, 30*time.Second)
+	c.Assert(d.windowFor(routingContainer("myapp", "web", map[string]string{dedupLabel: "false"})), check.Equals, time.Duration(0))
+	enabled := routingContainer("myapp", "web", map[string]string{dedupLabel: "5"})
+	c.Assert(d.windowFor(enabled), check.Equals, 5*time.Second)
+	c.Assert(d.filter(msg, enabled), check.Equals, true)
+	c.Assert(d.filter(msg, enabled), check.Equals, false)
+	d.flush()
+	c.Assert(sent.contents(), check.DeepEquals, []string{"last message repeated 1 times"})
+}
+
+func (s *S) TestLogDeduplicatorSendsWithoutLock(c *check.C) {
+	os.Setenv("LOG_DEDUP_ENABLE", "true")
+	defer os.Unsetenv("LOG_DEDUP_ENABLE")
+	var d *logDeduplicator
+	cont := routingContainer("myapp", "web", nil)
+	var filtered []bool
+	d = newLogDeduplicator(func(parts *rawLogParts, c *container.Container) {
+		// Forwarding may handle other messages, which must not block.
+		filtered = append(filtered, d.filter(&rawLogParts{content: parts.content, container: []byte("cont2")}, cont))
+	})
+	msg := &rawLogParts{content: []byte("crashed"), container: []byte("cont1")}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.filter(msg, cont)
+		d.filter(msg, cont)
+		d.filter(&rawLogParts{content: []byte("starting"), container: []byte("cont1")}, cont)
+		d.filter(msg, cont)
+		d.filter(msg, cont)
+		d.flush()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for the deduplicator, sending while holding the lock")
+	}
+	c.Assert(filtered, check.DeepEquals, []bool{true, true})
+}
+
+func (s *S) TestLogDeduplicatorExpireAfterReset(c *check.C) {
+	os.Setenv("LOG_DEDUP_ENABLE", "true")
+	defer os.Unsetenv("LOG_DEDUP_ENABLE")
+	var sent sentParts
+	d := newLogDeduplicator(sent.send)
+	defer d.flush()
+	now := time.Now()
+	d.now = func() time.Time { return now }
+	cont := routingContainer("myapp", "web", nil)
+	msg := &rawLogParts{content: []byte("crashed"), container: []byte("cont1")}
+	c.Assert(d.filter(msg, cont), check.Equals, true)
+	e := d.entries["cont1"]
+	now = now.Add(time.Minute)
+	c.Assert(d.filter(msg, cont), check.Equals, true)
+	c.Assert(d.filter(msg, cont), check.Equals, false)
+	// The timer fired before the entry was reset by the new message.
+	d.expire(e)
+	c.Assert(d.entries["cont1"], check.Equals, e)
+	c.Assert(sent.contents(), check.HasLen, 0)
+	now = now.Add(time.Minute)
+	d.expire(e)
+	c.Assert(d.entries, check.HasLen, 0)
+	c.Assert(sent.contents(), check.DeepEquals, []string{"last message repeated 1 times"})
+}
@@ -0,0 +1,134 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tsuru/bs/telemetry"
+	"gopkg.in/check.v1"
+)
+
+type fakeForwarder struct {
+	mu         sync.Mutex
+	connectErr error
+	processErr error
+	processed  []LogMessage
+	closed     int
+}
+
+func (f *fakeForwarder) connect() (net.Conn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.connectErr != nil {
+		return nil, f.connectErr
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+func (f *fakeForwarder) process(conn net.Conn, msg LogMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.processErr != nil {
+		return f.processErr
+	}
+	f.processed = append(f.processed, msg)
+	return nil
+}
+
+func (f *fakeForwarder) close(conn net.Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed++
+	conn.Close()
+}
+
+func (s *S) TestDrainMessages(c *check.C) {
+	f := &fakeForwarder{}
+	ch := make(chan LogMessage, 10)
+	for _, msg := range []string{"a", "b", "c"} {
+		ch <- msg
+	}
+	flushed, abandoned := drainMessages(f, nil, ch, newCircuitBreaker("fake"), &backendTelemetry{}, time.Second)
+	c.Assert(flushed, check.Equals, 3)
+	c.Assert(abandoned, check.Equals, 0)
+	c.Assert(f.processed, check.DeepEquals, []LogMessage{"a", "b", "c"})
+	c.Assert(f.closed, check.Equals, 1)
+}
+
+func (s *S) TestDrainMessagesAbandoned(c *check.C) {
+	f := &fakeForwarder{connectErr: errors.New("connection refused")}
+	ch := make(chan LogMessage, 10)
+	for _, msg := range []string{"a", "b", "c"} {
+		ch <- msg
+	}
+	flushed, abandoned := drainMessages(f, nil, ch, newCircuitBreaker("fake"), &backendTelemetry{}, 200*time.Millisecond)
+	c.Assert(flushed, check.Equals, 0)
+	c.Assert(abandoned, check.Equals, 3)
+	f.connectErr = nil
+	f.processErr = errors.New("broken pipe")
+	flushed, abandoned = drainMessages(f, nil, ch, newCircuitBreaker("fake"), &backendTelemetry{}, time.Second)
+	c.Assert(flushed, check.Equals, 0)
+	c.Assert(abandoned, check.Equals, 3)
+	c.Assert(ch, check.HasLen, 0)
+	c.Assert(f.closed, check.Equals, 3)
+}
+
+func (s *S) TestProcessMessagesDrainOnStop(c *check.C) {
+	f := &fakeForwarder{}
+	w, err := startForwarder(f, forwarderName(f), &forwarderTelemetry{backendTelemetry: &backendTelemetry{}}, make(chan LogMessage, 10), nil)
+	c.Assert(err, check.IsNil)
+	f.mu.Lock()
+	for _, msg := range []string{"a", "b", "c"} {
+		w.ch <- msg
+	}
+	w.stop(true)
+	f.mu.Unlock()
+	timeout := time.After(5 * time.Second)
+	for {
+		f.mu.Lock()
+		closed := f.closed
+		f.mu.Unlock()
+		if closed > 0 {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for forwarder to drain")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	c.Assert(f.processed, check.DeepEquals, []LogMessage{"a", "b", "c"})
+}
+
+type unackedFakeForwarder struct {
+	fakeForwarder
+}
+
+func (f *unackedFakeForwarder) unacked() int {
+	return 2
+}
+
+func (s *S) TestProcessMessagesUnackedDroppedOnStop(c *check.C) {
+	f := &unackedFakeForwarder{}
+	stats := &forwarderTelemetry{backendTelemetry: &backendTelemetry{dropped: telemetry.NewCounter("bs_log_test_unacked_dropped")}}
+	w, err := startForwarder(f, forwarderName(f), stats, make(chan LogMessage, 10), nil)
+	c.Assert(err, check.IsNil)
+	w.stop(true)
+	timeout := time.After(5 * time.Second)
+	for stats.dropped.Value() == 0 {
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for forwarder to stop")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	c.Assert(stats.dropped.Value(), check.Equals, uint64(2))
+}
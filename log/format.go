@@ -8,6 +8,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"strconv"
 	"time"
 
 	"gopkg.in/mcuadros/go-syslog.v2/format"
@@ -34,6 +35,15 @@ func (p *rawLogParts) String() string {
 	return fmt.Sprintf("{log entry: %v %q %q %q}", p.ts, string(p.priority), string(p.content), string(p.container))
 }
 
+// severity returns the syslog severity encoded in the entry priority.
+func (p *rawLogParts) severity() (int, bool) {
+	pr, err := strconv.Atoi(string(p.priority))
+	if err != nil {
+		return 0, false
+	}
+	return pr & severityMask, true
+}
+
 type LenientParser struct {
 	line  []byte
 	parts rawLogParts
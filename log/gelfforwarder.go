@@ -5,6 +5,10 @@
 package log
 
 import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
 	"net"
 	"strconv"
 	"strings"
@@ -14,18 +18,24 @@ import (
 	"github.com/tsuru/bs/bslog"
 	"github.com/tsuru/bs/config"
 	"github.com/tsuru/bs/container"
+	"github.com/tsuru/bs/telemetry"
 )
 
 const fieldSeparators = " \t"
 
+// gelfSettings are the environment variables used by the gelf backend.
+var gelfSettings = []string{"LOG_GELF_", "LOG_BUFFER_SIZE", "LOG_DRAIN_TIMEOUT"}
+
 type gelfBackend struct {
+	envSnapshot
 	host             string
 	chunkSize        int
 	fieldsWhitelist  []string
 	whitelistToField map[string]string
-	msgCh            chan<- LogMessage
-	quitCh           chan<- bool
+	sender           *shardedSender
 	nextNotify       *time.Timer
+	dropOnOpen       bool
+	bytesSent        *telemetry.Counter
 }
 
 func (b *gelfBackend) setup() {
@@ -44,18 +54,35 @@ func (b *gelfBackend) setup() {
 		b.whitelistToField[f] = "_" + f
 	}
 	b.whitelistToField["level"] = ""
+	b.dropOnOpen = config.BoolEnvOrDefault(false, "LOG_GELF_DROP_ON_OPEN_CIRCUIT")
 	b.nextNotify = time.NewTimer(0)
+	b.bytesSent = newBackendTelemetry("gelf").bytesSent
 }
 
 func (b *gelfBackend) initialize() error {
+	return b.init(nil)
+}
+
+// init starts the forwarders of the backend, replacing the ones of prev if
+// not nil.
+func (b *gelfBackend) init(prev *shardedSender) error {
+	b.envSnapshot = takeEnvSnapshot(gelfSettings...)
 	b.setup()
 	bufferSize := config.IntEnvOrDefault(config.DefaultBufferSize, "LOG_GELF_BUFFER_SIZE", "LOG_BUFFER_SIZE")
+	workers := config.IntEnvOrDefault(1, "LOG_GELF_WORKERS")
 	var err error
-	b.msgCh, b.quitCh, err = processMessages(b, bufferSize)
-	if err != nil {
-		return err
+	b.sender, err = newShardedSender("gelf", workers, bufferSize, func() forwarderBackend {
+		return b
+	}, prev)
+	return err
+}
+
+func (b *gelfBackend) restart() (*backendChange, error) {
+	replacement := &gelfBackend{}
+	if err := replacement.init(b.sender); err != nil {
+		return nil, err
 	}
-	return nil
+	return replaceSender(replacement, b.sender, replacement.sender), nil
 }
 
 func (b *gelfBackend) sendMessage(parts *rawLogParts, c *container.Container) {
@@ -77,9 +104,7 @@ func (b *gelfBackend) sendMessage(parts *rawLogParts, c *container.Container) {
 		RawExtra: *c.RawExtra,
 		TimeUnix: float64(time.Now().UnixNano()) / float64(time.Second),
 	}
-	select {
-	case b.msgCh <- msg:
-	default:
+	if !b.sender.send(appKey(c), msg) {
 		select {
 		case <-b.nextNotify.C:
 			bslog.Errorf("Dropping log messages to gelf due to full channel buffer.")
@@ -89,46 +114,134 @@ func (b *gelfBackend) sendMessage(parts *rawLogParts, c *container.Container) {
 	}
 }
 func (b *gelfBackend) stop() {
-	close(b.quitCh)
+	b.sender.stop()
 }
 
-type gelfConnWrapper struct {
+// gelfChunkHeaderLen is the size of the header of each chunk: the magic
+// bytes, the message id, the sequence number and the number of chunks.
+const gelfChunkHeaderLen = 12
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// gelfConn sends uncompressed gelf messages through UDP, splitting them in
+// chunks when larger than chunkSize, and counts the bytes written to the
+// socket.
+type gelfConn struct {
 	net.Conn
-	*gelf.UDPWriter
+	chunkSize int
+	buf       bytes.Buffer
+	chunk     bytes.Buffer
+	written   int
+}
+
+func (c *gelfConn) Write(data []byte) (int, error) {
+	n, err := c.Conn.Write(data)
+	c.written += n
+	if err == nil && n != len(data) {
+		err = fmt.Errorf("short gelf write (%d/%d)", n, len(data))
+	}
+	return n, err
+}
+
+// writeMessage encodes and sends the message, returning the number of bytes
+// written to the socket, including chunk headers.
+func (c *gelfConn) writeMessage(msg *gelf.Message) (int, error) {
+	c.buf.Reset()
+	if err := msg.MarshalJSONBuf(&c.buf); err != nil {
+		return 0, err
+	}
+	c.written = 0
+	data := c.buf.Bytes()
+	if len(data) <= c.chunkSize {
+		_, err := c.Write(data)
+		return c.written, err
+	}
+	err := c.writeChunked(data)
+	return c.written, err
+}
+
+func (c *gelfConn) writeChunked(data []byte) error {
+	chunkDataLen := c.chunkSize - gelfChunkHeaderLen
+	if chunkDataLen <= 0 {
+		return fmt.Errorf("invalid gelf chunk size %d", c.chunkSize)
+	}
+	chunks := (len(data) + chunkDataLen - 1) / chunkDataLen
+	if chunks > 128 {
+		return fmt.Errorf("gelf message too large, would need %d chunks", chunks)
+	}
+	msgID := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, msgID); err != nil {
+		return err
+	}
+	for i := 0; i < chunks; i++ {
+		end := (i + 1) * chunkDataLen
+		if end > len(data) {
+			end = len(data)
+		}
+		c.chunk.Reset()
+		c.chunk.Write(gelfChunkMagic)
+		c.chunk.Write(msgID)
+		c.chunk.WriteByte(byte(i))
+		c.chunk.WriteByte(byte(chunks))
+		c.chunk.Write(data[i*chunkDataLen : end])
+		if _, err := c.Write(c.chunk.Bytes()); err != nil {
+			return fmt.Errorf("unable to write gelf chunk %d/%d: %s", i, chunks, err)
+		}
+	}
+	return nil
 }
 
-func (w *gelfConnWrapper) Close() error {
-	return w.UDPWriter.Close()
+func (b *gelfBackend) String() string {
+	return "gelf " + b.host
 }
 
-func (w *gelfConnWrapper) Write(msg []byte) (int, error) {
-	return 0, nil
+func (b *gelfBackend) dropOnOpenCircuit() bool {
+	return b.dropOnOpen
 }
 
 func (b *gelfBackend) connect() (net.Conn, error) {
-	writer, err := gelf.NewUDPWriter(b.host)
+	conn, err := net.Dial("udp", b.host)
 	if err != nil {
 		return nil, err
 	}
-	writer.CompressionType = gelf.CompressNone
-	writer.ChunkSize = b.chunkSize
-	return &gelfConnWrapper{UDPWriter: writer}, nil
+	return &gelfConn{Conn: conn, chunkSize: b.chunkSize}, nil
 }
 
 func (b *gelfBackend) parseFields(gelfMsg *gelf.Message) {
 	msg := gelfMsg.Short
+	for {
+		key, value, rest, ok := nextField(msg, b.whitelistToField)
+		if !ok {
+			break
+		}
+		msg = rest
+
+		if key == "level" {
+			level := parseMsgLevel(value)
+			if level > 0 {
+				gelfMsg.Level = level
+			}
+		} else {
+			gelfMsg.Extra[b.whitelistToField[key]] = value
+		}
+	}
+}
+
+// nextField finds the next key=value field in msg whose key is present in
+// allowed, returning it along with the remaining of the message. Fields are
+// separated by spaces or tabs.
+func nextField(msg string, allowed map[string]string) (key, value, rest string, ok bool) {
 	for {
 		idx := strings.IndexByte(msg, '=')
 		if idx == -1 {
-			break
+			return "", "", "", false
 		}
 
 		start := strings.LastIndexAny(msg[:idx], fieldSeparators)
-		key := msg[start+1 : idx]
+		key = msg[start+1 : idx]
 		msg = msg[idx+1:]
 
-		underKey, allowed := b.whitelistToField[key]
-		if !allowed {
+		if _, found := allowed[key]; !found {
 			continue
 		}
 
@@ -136,17 +249,7 @@ func (b *gelfBackend) parseFields(gelfMsg *gelf.Message) {
 		if end == -1 {
 			end = len(msg)
 		}
-		value := msg[:end]
-		msg = msg[end:]
-
-		if key == "level" {
-			level := parseMsgLevel(value)
-			if level > 0 {
-				gelfMsg.Level = level
-			}
-		} else {
-			gelfMsg.Extra[underKey] = value
-		}
+		return key, msg[:end], msg[end:], true
 	}
 }
 
@@ -176,7 +279,12 @@ func parseMsgLevel(level string) int32 {
 func (b *gelfBackend) process(conn net.Conn, msg LogMessage) error {
 	gelfMsg := msg.(*gelf.Message)
 	b.parseFields(gelfMsg)
-	return conn.(*gelfConnWrapper).WriteMessage(gelfMsg)
+	n, err := conn.(*gelfConn).writeMessage(gelfMsg)
+	if err != nil {
+		return err
+	}
+	b.bytesSent.Add(uint64(n))
+	return nil
 }
 
 func (b *gelfBackend) close(conn net.Conn) {
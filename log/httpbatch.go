@@ -0,0 +1,210 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	tsuruTransportWebsocket = "websocket"
+	tsuruTransportHTTP      = "http"
+	tsuruTransportAuto      = "auto"
+
+	httpBatchTimeout = 10 * time.Second
+)
+
+var errHTTPBatchConnClosed = errors.New("http batch connection closed")
+
+type httpAddr string
+
+func (a httpAddr) Network() string { return "http" }
+func (a httpAddr) String() string  { return string(a) }
+
+// httpBatchConn is a net.Conn accumulating JSON encoded entries which are
+// posted to the tsuru API as a gzipped JSON array, either when the batch is
+// full or every interval. After a successful post onDelivered is called with
+// the highest sequence number in the batch. Entries of a failed post are
+// retried in the next one, onDropped is called with the number of entries
+// still not posted when the connection is closed.
+type httpBatchConn struct {
+	url         string
+	token       string
+	client      *http.Client
+	batchSize   int
+	onDelivered func(seq uint64)
+	onDropped   func(n int)
+
+	// sendMu serializes posts, which are sent without holding mu so that
+	// entries can be added meanwhile.
+	sendMu  sync.Mutex
+	mu      sync.Mutex
+	entries [][]byte
+	lastSeq uint64
+	err     error
+	closed  bool
+	done    chan struct{}
+}
+
+func newHTTPBatchConn(url, token string, client *http.Client, batchSize int, interval time.Duration, onDelivered func(uint64), onDropped func(int)) *httpBatchConn {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	c := &httpBatchConn{
+		url:         url,
+		token:       token,
+		client:      client,
+		batchSize:   batchSize,
+		onDelivered: onDelivered,
+		onDropped:   onDropped,
+		done:        make(chan struct{}),
+	}
+	if interval > 0 {
+		go c.flushLoop(interval)
+	}
+	return c
+}
+
+// add appends a JSON encoded entry to the batch, posting it if it's full.
+// Errors from previous background posts are returned here, so the forwarder
+// can reconnect.
+func (c *httpBatchConn) add(data []byte, seq uint64) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errHTTPBatchConnClosed
+	}
+	if c.err != nil {
+		err := c.err
+		c.err = nil
+		c.mu.Unlock()
+		return err
+	}
+	c.entries = append(c.entries, bytes.TrimRight(data, "\n"))
+	if seq > c.lastSeq {
+		c.lastSeq = seq
+	}
+	full := len(c.entries) >= c.batchSize
+	c.mu.Unlock()
+	if full {
+		return c.flush()
+	}
+	return nil
+}
+
+// flush posts the pending entries, putting them back in front of the batch
+// if the post fails.
+func (c *httpBatchConn) flush() error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	c.mu.Lock()
+	entries, lastSeq := c.entries, c.lastSeq
+	c.entries = nil
+	c.mu.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := c.post(entries); err != nil {
+		c.mu.Lock()
+		c.entries = append(entries, c.entries...)
+		c.mu.Unlock()
+		return err
+	}
+	if c.onDelivered != nil && lastSeq > 0 {
+		c.onDelivered(lastSeq)
+	}
+	return nil
+}
+
+func (c *httpBatchConn) post(entries [][]byte) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte{'['})
+	gz.Write(bytes.Join(entries, []byte{','}))
+	gz.Write([]byte{']'})
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Authorization", "bearer "+c.token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to post log batch: %s", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unable to post log batch: unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *httpBatchConn) flushLoop(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+			if err := c.flush(); err != nil {
+				c.mu.Lock()
+				c.err = err
+				c.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (c *httpBatchConn) Write(data []byte) (int, error) {
+	err := c.add(data, 0)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (c *httpBatchConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	c.mu.Unlock()
+	err := c.flush()
+	if err != nil {
+		c.mu.Lock()
+		dropped := len(c.entries)
+		c.entries = nil
+		c.mu.Unlock()
+		if c.onDropped != nil {
+			c.onDropped(dropped)
+		}
+	}
+	return err
+}
+
+func (c *httpBatchConn) Read(b []byte) (int, error)         { return 0, io.EOF }
+func (c *httpBatchConn) LocalAddr() net.Addr                { return httpAddr("") }
+func (c *httpBatchConn) RemoteAddr() net.Addr               { return httpAddr(c.url) }
+func (c *httpBatchConn) SetDeadline(t time.Time) error      { return nil }
+func (c *httpBatchConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *httpBatchConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,241 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"golang.org/x/net/websocket"
+	"gopkg.in/check.v1"
+)
+
+type fakeTsuruLogs struct {
+	mu        sync.Mutex
+	wsEnabled bool
+	status    int
+	batches   [][]map[string]interface{}
+	headers   []http.Header
+}
+
+func (f *fakeTsuruLogs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method != "POST" {
+		if !f.wsEnabled {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		f.mu.Unlock()
+		defer f.mu.Lock()
+		websocket.Handler(func(ws *websocket.Conn) {
+			var discard []byte
+			for websocket.Message.Receive(ws, &discard) == nil {
+			}
+		}).ServeHTTP(w, r)
+		return
+	}
+	f.headers = append(f.headers, r.Header)
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var batch []map[string]interface{}
+	if err = json.NewDecoder(gz).Decode(&batch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.batches = append(f.batches, batch)
+}
+
+func (f *fakeTsuruLogs) messages() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var result [][]string
+	for _, batch := range f.batches {
+		var msgs []string
+		for _, entry := range batch {
+			msgs = append(msgs, entry["Message"].(string))
+		}
+		result = append(result, msgs)
+	}
+	return result
+}
+
+func (f *fakeTsuruLogs) setWebsocket(enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.wsEnabled = enabled
+}
+
+func newTestHTTPForwarder(srvURL, transport string, quit <-chan bool) *wsForwarder {
+	return &wsForwarder{
+		url:               "ws" + strings.TrimPrefix(srvURL, "http") + "/logs",
+		httpURL:           srvURL + "/logs",
+		token:             "mytoken",
+		transport:         transport,
+		httpClient:        &http.Client{},
+		httpBatchSize:     2,
+		httpFallbackAfter: 2,
+		httpRetryInterval: 100 * time.Millisecond,
+		pingInterval:      time.Minute,
+		pongInterval:      2 * time.Minute,
+		connMaxAge:        -1,
+		quitCh:            quit,
+	}
+}
+
+func (s *S) TestHTTPBatchConn(c *check.C) {
+	logs := &fakeTsuruLogs{}
+	srv := httptest.NewServer(logs)
+	defer srv.Close()
+	var delivered uint64
+	conn := newHTTPBatchConn(srv.URL+"/logs", "mytoken", &http.Client{}, 2, 0, func(seq uint64) {
+		delivered = seq
+	}, nil)
+	c.Assert(conn.add([]byte(`{"Message":"a"}`+"\n"), 1), check.IsNil)
+	c.Assert(logs.messages(), check.HasLen, 0)
+	c.Assert(conn.add([]byte(`{"Message":"b"}`), 2), check.IsNil)
+	c.Assert(logs.messages(), check.DeepEquals, [][]string{{"a", "b"}})
+	c.Assert(delivered, check.Equals, uint64(2))
+	c.Assert(logs.headers[0].Get("Authorization"), check.Equals, "bearer mytoken")
+	c.Assert(logs.headers[0].Get("Content-Encoding"), check.Equals, "gzip")
+	c.Assert(logs.headers[0].Get("Content-Type"), check.Equals, "application/json")
+	c.Assert(conn.add([]byte(`{"Message":"c"}`), 3), check.IsNil)
+	logs.status = http.StatusServiceUnavailable
+	c.Assert(conn.add([]byte(`{"Message":"d"}`), 4), check.ErrorMatches, `unable to post log batch: unexpected status code 503`)
+	c.Assert(delivered, check.Equals, uint64(2))
+	logs.status = 0
+	c.Assert(conn.Close(), check.IsNil)
+	c.Assert(logs.messages(), check.DeepEquals, [][]string{{"a", "b"}, {"c", "d"}})
+	c.Assert(delivered, check.Equals, uint64(4))
+	c.Assert(conn.add([]byte(`{"Message":"e"}`), 5), check.Equals, errHTTPBatchConnClosed)
+}
+
+func (s *S) TestHTTPBatchConnDroppedOnClose(c *check.C) {
+	logs := &fakeTsuruLogs{status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(logs)
+	defer srv.Close()
+	var dropped int
+	conn := newHTTPBatchConn(srv.URL+"/logs", "mytoken", &http.Client{}, 2, 0, nil, func(n int) {
+		dropped += n
+	})
+	c.Assert(conn.add([]byte(`{"Message":"a"}`), 0), check.IsNil)
+	c.Assert(conn.add([]byte(`{"Message":"b"}`), 0), check.ErrorMatches, `unable to post log batch: unexpected status code 503`)
+	c.Assert(conn.add([]byte(`{"Message":"c"}`), 0), check.ErrorMatches, `unable to post log batch: unexpected status code 503`)
+	c.Assert(dropped, check.Equals, 0)
+	c.Assert(conn.Close(), check.ErrorMatches, `unable to post log batch: unexpected status code 503`)
+	c.Assert(dropped, check.Equals, 3)
+}
+
+func (s *S) TestHTTPBatchConnAddDuringPost(c *check.C) {
+	posting := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case posting <- struct{}{}:
+			<-release
+		default:
+		}
+	}))
+	defer srv.Close()
+	conn := newHTTPBatchConn(srv.URL+"/logs", "mytoken", &http.Client{}, 2, 0, nil, nil)
+	c.Assert(conn.add([]byte(`{"Message":"a"}`), 0), check.IsNil)
+	done := make(chan error)
+	go func() {
+		done <- conn.add([]byte(`{"Message":"b"}`), 0)
+	}()
+	<-posting
+	added := make(chan error)
+	go func() {
+		added <- conn.add([]byte(`{"Message":"c"}`), 0)
+	}()
+	select {
+	case err := <-added:
+		c.Assert(err, check.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("add blocked while posting batch")
+	}
+	close(release)
+	c.Assert(<-done, check.IsNil)
+	c.Assert(conn.Close(), check.IsNil)
+}
+
+func (s *S) TestHTTPBatchConnFlushInterval(c *check.C) {
+	logs := &fakeTsuruLogs{}
+	srv := httptest.NewServer(logs)
+	defer srv.Close()
+	conn := newHTTPBatchConn(srv.URL+"/logs", "mytoken", &http.Client{}, 10, 50*time.Millisecond, nil, nil)
+	defer conn.Close()
+	c.Assert(conn.add([]byte(`{"Message":"a"}`), 0), check.IsNil)
+	timeout := time.After(5 * time.Second)
+	for len(logs.messages()) == 0 {
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for batch")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	c.Assert(logs.messages(), check.DeepEquals, [][]string{{"a"}})
+}
+
+func (s *S) TestWsForwarderHTTPTransport(c *check.C) {
+	logs := &fakeTsuruLogs{wsEnabled: true}
+	srv := httptest.NewServer(logs)
+	defer srv.Close()
+	f := newTestHTTPForwarder(srv.URL, tsuruTransportHTTP, nil)
+	conn, err := f.connect()
+	c.Assert(err, check.IsNil)
+	c.Assert(conn, check.FitsTypeOf, &httpBatchConn{})
+	for _, msg := range []string{"a", "b", "c"} {
+		c.Assert(f.process(conn, &app.Applog{Message: msg}), check.IsNil)
+	}
+	f.close(conn)
+	c.Assert(logs.messages(), check.DeepEquals, [][]string{{"a", "b"}, {"c"}})
+}
+
+func (s *S) TestWsForwarderAutoTransport(c *check.C) {
+	logs := &fakeTsuruLogs{}
+	srv := httptest.NewServer(logs)
+	defer srv.Close()
+	quit := make(chan bool)
+	defer close(quit)
+	f := newTestHTTPForwarder(srv.URL, tsuruTransportAuto, quit)
+	conn, err := f.connect()
+	c.Assert(err, check.NotNil)
+	c.Assert(conn, check.IsNil)
+	conn, err = f.connect()
+	c.Assert(err, check.IsNil)
+	c.Assert(conn, check.FitsTypeOf, &httpBatchConn{})
+	c.Assert(f.process(conn, &app.Applog{Message: "a"}), check.IsNil)
+	logs.setWebsocket(true)
+	time.Sleep(150 * time.Millisecond)
+	c.Assert(f.process(conn, &app.Applog{Message: "b"}), check.Equals, errConnMaxAgeExceeded)
+	f.close(conn)
+	c.Assert(logs.messages(), check.DeepEquals, [][]string{{"a", "b"}})
+	conn, err = f.connect()
+	c.Assert(err, check.IsNil)
+	c.Assert(conn, check.FitsTypeOf, &bufferedConn{})
+	f.close(conn)
+	logs.setWebsocket(false)
+	conn, err = f.connect()
+	c.Assert(err, check.NotNil)
+	c.Assert(conn, check.IsNil)
+	conn, err = f.connect()
+	c.Assert(err, check.IsNil)
+	c.Assert(conn, check.FitsTypeOf, &httpBatchConn{})
+	f.close(conn)
+}
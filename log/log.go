@@ -5,10 +5,15 @@
 package log
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/url"
+	"os"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tsuru/bs/bslog"
@@ -41,9 +46,19 @@ type LogForwarder struct {
 	EnabledBackends []string
 	infoClient      *container.InfoClient
 	server          *syslog.Server
+	mu              sync.RWMutex
 	backends        []logBackend
+	backendNames    []string
+	router          *logRouter
+	rateLimiter     *logRateLimiter
+	redactor        *logRedactor
+	metrics         *logMetrics
+	deduplicator    *logDeduplicator
 	formatter       *LenientFormat
 	kubeStreamer    *kubernetesLogStreamer
+	running         int32
+	reloadMu        sync.Mutex
+	stopped         bool
 }
 
 type forwarderBackend interface {
@@ -58,64 +73,309 @@ type logBackend interface {
 	stop()
 }
 
-func processMessages(forwarder forwarderBackend, bufferSize int) (chan<- LogMessage, chan<- bool, error) {
-	ch := make(chan LogMessage, bufferSize)
-	quit := make(chan bool)
+// reloadableBackend may be implemented by backends able to apply
+// configuration changes without losing their buffered messages. reload
+// prepares the change, which is only applied once every backend was
+// prepared.
+type reloadableBackend interface {
+	reload() (*backendChange, error)
+}
+
+// restartableBackend may be implemented by backends unable to apply
+// configuration changes in place. On reload, they're replaced by a new
+// instance when their settings changed, which takes over the messages
+// buffered by the previous instance.
+type restartableBackend interface {
+	settingsChanged() bool
+	restart() (*backendChange, error)
+}
+
+// backendChange is a change to a log backend prepared on reload, committed
+// after every backend was prepared or discarded if any of them failed.
+type backendChange struct {
+	backend logBackend
+	commit  func()
+	discard func()
+}
+
+func (c *backendChange) apply() {
+	if c.commit != nil {
+		c.commit()
+	}
+}
+
+func (c *backendChange) cancel() {
+	if c.discard != nil {
+		c.discard()
+	}
+}
+
+// envSnapshot holds the values of the environment variables used by a
+// backend when it was initialized.
+type envSnapshot struct {
+	names  []string
+	values map[string]string
+}
+
+// takeEnvSnapshot returns the current values of the environment variables
+// with the given names, names ending with "_" matching every variable with
+// that prefix.
+func takeEnvSnapshot(names ...string) envSnapshot {
+	values := make(map[string]string)
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		for _, name := range names {
+			if parts[0] == name || (strings.HasSuffix(name, "_") && strings.HasPrefix(parts[0], name)) {
+				values[parts[0]] = parts[1]
+				break
+			}
+		}
+	}
+	return envSnapshot{names: names, values: values}
+}
+
+func (e envSnapshot) settingsChanged() bool {
+	return len(e.changedSettings()) > 0
+}
+
+// changedSettings returns the sorted names of the environment variables
+// changed since the snapshot was taken.
+func (e envSnapshot) changedSettings() []string {
+	current := takeEnvSnapshot(e.names...).values
+	var changed []string
+	for name, value := range current {
+		if prev, ok := e.values[name]; !ok || prev != value {
+			changed = append(changed, name)
+		}
+	}
+	for name := range e.values {
+		if _, ok := current[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// circuitPolicy may be implemented by forwarders choosing to discard
+// messages, instead of buffering them, while their circuit is open.
+type circuitPolicy interface {
+	dropOnOpenCircuit() bool
+}
+
+// unackedCounter may be implemented by forwarders keeping sent messages
+// until they are acknowledged, unacked returns how many are still waiting.
+type unackedCounter interface {
+	unacked() int
+}
+
+// forwarderWorker is the goroutine sending the messages buffered in ch
+// through a forwarder.
+type forwarderWorker struct {
+	ch    chan LogMessage
+	quit  chan bool
+	done  chan bool
+	drain int32
+}
+
+// stop stops the worker, draining the buffered messages first if drain is
+// set. Otherwise they're kept in the buffer, to be taken over by another
+// worker.
+func (w *forwarderWorker) stop(drain bool) {
+	if drain {
+		atomic.StoreInt32(&w.drain, 1)
+	}
+	close(w.quit)
+}
+
+// startForwarder connects the forwarder and starts a worker sending the
+// messages buffered in ch. If start is not nil, messages are only sent after
+// start is closed.
+func startForwarder(forwarder forwarderBackend, name string, stats *forwarderTelemetry, ch chan LogMessage, start <-chan struct{}) (*forwarderWorker, error) {
+	w := &forwarderWorker{
+		ch:   ch,
+		quit: make(chan bool),
+		done: make(chan bool),
+	}
 	if initializable, ok := forwarder.(interface {
 		initialize(<-chan bool)
 	}); ok {
-		initializable.initialize(quit)
+		initializable.initialize(w.done)
 	}
 	conn, err := forwarder.connect()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	var dropOnOpen bool
+	if policy, ok := forwarder.(circuitPolicy); ok {
+		dropOnOpen = policy.dropOnOpenCircuit()
+	}
+	drainTimeout := config.SecondsEnvOrDefault(10, "LOG_DRAIN_TIMEOUT")
+	breaker := newCircuitBreaker(name)
+	breaker.register()
 	stopWg.Add(1)
 	go func() {
 		defer stopWg.Done()
-		var err error
-		for {
+		defer breaker.unregister()
+		defer close(w.done)
+		if start != nil {
 			select {
-			case <-quit:
+			case <-start:
+			case <-w.quit:
+				forwarder.close(conn)
 				return
-			default:
 			}
-			if conn == nil {
-				conn, err = forwarder.connect()
-				if err != nil {
-					conn = nil
-					time.Sleep(100 * time.Millisecond)
-					continue
+		}
+		conn = forwardMessages(forwarder, conn, ch, w.quit, breaker, stats, dropOnOpen)
+		if atomic.LoadInt32(&w.drain) == 1 {
+			flushed, abandoned := drainMessages(forwarder, conn, ch, breaker, stats.backendTelemetry, drainTimeout)
+			stats.abandoned.Add(uint64(abandoned))
+			if flushed > 0 || abandoned > 0 {
+				bslog.Warnf("[log forwarder] drained %s: %d log messages flushed, %d abandoned", breaker.name, flushed, abandoned)
+			}
+		} else if conn != nil {
+			forwarder.close(conn)
+		}
+		if counter, ok := forwarder.(unackedCounter); ok {
+			if unacked := counter.unacked(); unacked > 0 {
+				stats.drop(unacked)
+				bslog.Warnf("[log forwarder] stopped %s: %d log messages dropped without acknowledgement", breaker.name, unacked)
+			}
+		}
+	}()
+	return w, nil
+}
+
+// forwardMessages sends messages received in ch through the forwarder,
+// reconnecting on failures, until quit is closed. It returns the current
+// connection, if any, to be used while draining.
+func forwardMessages(forwarder forwarderBackend, conn net.Conn, ch <-chan LogMessage, quit <-chan bool, breaker *circuitBreaker, stats *forwarderTelemetry, dropOnOpen bool) net.Conn {
+	var err error
+	for {
+		select {
+		case <-quit:
+			return conn
+		default:
+		}
+		if conn == nil {
+			breaker.attempt()
+			stats.reconnects.Inc()
+			conn, err = forwarder.connect()
+			if err != nil {
+				conn = nil
+				if !waitReconnect(breaker.failure(err), breaker, dropOnOpen, ch, quit, stats) {
+					return nil
 				}
+				continue
 			}
-		loop:
-			for {
-				select {
-				case <-quit:
+			breaker.connected()
+		}
+	loop:
+		for {
+			select {
+			case <-quit:
+				return conn
+			case msg := <-ch:
+				if msg == nil {
+					return conn
+				}
+				err = forwarder.process(conn, msg)
+				if err != nil {
 					break loop
-				case msg := <-ch:
-					if msg == nil {
-						break loop
-					}
-					err = forwarder.process(conn, msg)
-					if err != nil {
-						break loop
-					}
 				}
+				stats.sent.Inc()
+				breaker.delivered()
 			}
-			forwarder.close(conn)
-			switch err {
-			case nil:
-				return
-			case errConnMaxAgeExceeded:
-				bslog.Warnf("[log forwarder] connection max age exceeded, forcing reconnection")
-			default:
-				bslog.Errorf("[log forwarder] error writing to %#v: %s", forwarder, err)
+		}
+		forwarder.close(conn)
+		conn = nil
+		if err == errConnMaxAgeExceeded {
+			stats.sent.Inc()
+			bslog.Warnf("[log forwarder] connection max age exceeded, forcing reconnection")
+			continue
+		}
+		stats.sendErrors.Inc()
+		bslog.Errorf("[log forwarder] error writing to %s: %s", breaker.name, err)
+		if !waitReconnect(breaker.failure(err), breaker, dropOnOpen, ch, quit, stats) {
+			return nil
+		}
+	}
+}
+
+// drainMessages flushes the messages still buffered in ch through the
+// forwarder, reconnecting if needed, until ch is empty or timeout expires. The
+// connection is closed afterwards, which also flushes buffered connections.
+// It returns the number of flushed and abandoned messages.
+func drainMessages(forwarder forwarderBackend, conn net.Conn, ch <-chan LogMessage, breaker *circuitBreaker, stats *backendTelemetry, timeout time.Duration) (flushed, abandoned int) {
+	deadline := time.Now().Add(timeout)
+	for len(ch) > 0 && time.Now().Before(deadline) {
+		if conn == nil {
+			breaker.attempt()
+			stats.reconnects.Inc()
+			var err error
+			conn, err = forwarder.connect()
+			if err != nil {
+				conn = nil
+				wait := breaker.failure(err)
+				if remaining := time.Until(deadline); wait > remaining {
+					wait = remaining
+				}
+				time.Sleep(wait)
+				continue
 			}
+			breaker.connected()
+		}
+		msg := <-ch
+		if msg == nil {
+			continue
+		}
+		err := forwarder.process(conn, msg)
+		if err == nil || err == errConnMaxAgeExceeded {
+			stats.sent.Inc()
+			flushed++
+		} else {
+			stats.sendErrors.Inc()
+			abandoned++
+		}
+		if err != nil {
+			forwarder.close(conn)
 			conn = nil
 		}
+	}
+	if conn != nil {
+		forwarder.close(conn)
+	}
+	return flushed, abandoned + len(ch)
+}
+
+// waitReconnect waits for the backoff duration before a reconnection
+// attempt, discarding buffered messages meanwhile if the circuit is open and
+// dropOnOpen is set, which are accounted in stats. It returns false if the
+// forwarder was stopped.
+func waitReconnect(backoff time.Duration, breaker *circuitBreaker, dropOnOpen bool, ch <-chan LogMessage, quit <-chan bool, stats *forwarderTelemetry) bool {
+	var dropCh <-chan LogMessage
+	if dropOnOpen && breaker.State() == circuitOpen {
+		dropCh = ch
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	var dropped int
+	defer func() {
+		if dropped > 0 {
+			bslog.Errorf("[log forwarder] dropped %d log messages to %s while circuit is open", dropped, breaker.name)
+		}
 	}()
-	return ch, quit, nil
+	for {
+		select {
+		case <-quit:
+			return false
+		case <-timer.C:
+			return true
+		case <-dropCh:
+			dropped++
+			stats.drop(1)
+		}
+	}
 }
 
 func (l *LogForwarder) Start() (err error) {
@@ -125,6 +385,8 @@ func (l *LogForwarder) Start() (err error) {
 		}
 	}()
 	if len(l.EnabledBackends) == 1 && l.EnabledBackends[0] == noneBackend {
+		// There's no syslog server to check when logging is disabled.
+		atomic.StoreInt32(&l.running, 1)
 		return
 	}
 	for _, backendName := range l.EnabledBackends {
@@ -138,15 +400,30 @@ func (l *LogForwarder) Start() (err error) {
 			return fmt.Errorf("unable to initialize log backend %q: %s", backendName, err)
 		}
 		l.backends = append(l.backends, backend)
+		l.backendNames = append(l.backendNames, backendName)
 	}
 	if len(l.backends) == 0 {
 		bslog.Warnf("no log backend enabled, discarding all received log messages.")
 	}
+	l.router, err = newLogRouter()
+	if err != nil {
+		return
+	}
+	l.redactor, err = newLogRedactor()
+	if err != nil {
+		return
+	}
+	l.deduplicator = newLogDeduplicator(l.forward)
 	l.infoClient, err = container.NewClient(l.DockerEndpoint)
 	if err != nil {
 		err = fmt.Errorf("unable to initialize docker client %s: %s", l.DockerEndpoint, err)
 		return
 	}
+	if config.BoolEnvOrDefault(true, "CONTAINER_CACHE_WATCH_EVENTS") {
+		if err := l.infoClient.WatchEvents(); err != nil {
+			bslog.Warnf("[log forwarder] unable to watch docker events: %s", err)
+		}
+	}
 	l.formatter = &LenientFormat{}
 	l.server = syslog.NewServer()
 	l.server.SetHandler(l)
@@ -173,28 +450,251 @@ func (l *LogForwarder) Start() (err error) {
 	} else if err != errNoLogDirectory {
 		return err
 	}
-	return l.server.Boot()
+	l.metrics, err = newLogMetrics()
+	if err != nil {
+		return
+	}
+	if l.metrics != nil {
+		l.metrics.start()
+	}
+	l.rateLimiter = newLogRateLimiter()
+	l.rateLimiter.start(l.forward)
+	err = l.server.Boot()
+	if err != nil {
+		return
+	}
+	atomic.StoreInt32(&l.running, 1)
+	return nil
+}
+
+// Healthy returns an error if the syslog server is not running or if the
+// circuit of any log forwarder is open.
+func (l *LogForwarder) Healthy() error {
+	if atomic.LoadInt32(&l.running) == 0 {
+		return errors.New("syslog server is not running")
+	}
+	for _, backend := range l.Backends() {
+		for _, f := range backend.Forwarders {
+			if f.Circuit == circuitOpen.String() {
+				return fmt.Errorf("circuit open for %s: %s", f.Name, f.LastError)
+			}
+		}
+	}
+	return nil
+}
+
+// Backends returns the state of the enabled log backends and their
+// forwarders.
+func (l *LogForwarder) Backends() []BackendState {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	states := make([]BackendState, 0, len(l.backendNames))
+	for _, name := range l.backendNames {
+		states = append(states, BackendState{
+			Name:       name,
+			Forwarders: backendForwarderStates(name),
+		})
+	}
+	return states
+}
+
+// KubernetesMonitors returns the state of the Kubernetes container log files
+// being streamed, it's empty when not running in Kubernetes.
+func (l *LogForwarder) KubernetesMonitors() []MonitorState {
+	if l.kubeStreamer == nil {
+		return []MonitorState{}
+	}
+	return l.kubeStreamer.states()
+}
+
+// InfoClient returns the client used to inspect containers, which is nil
+// until the forwarder is started or when no log backend is enabled.
+func (l *LogForwarder) InfoClient() *container.InfoClient {
+	return l.infoClient
+}
+
+// ContainerCache returns the state of the cache of inspected containers.
+func (l *LogForwarder) ContainerCache() container.CacheStats {
+	if l.infoClient == nil {
+		return container.CacheStats{}
+	}
+	return l.infoClient.CacheStats()
 }
 
 func (l *LogForwarder) Wait() {
 	if l.server != nil {
 		l.server.Wait()
 	}
+	l.mu.RLock()
+	rateLimiter := l.rateLimiter
+	l.mu.RUnlock()
+	if rateLimiter != nil {
+		rateLimiter.wait()
+	}
+	if l.metrics != nil {
+		l.metrics.wait()
+	}
 	stopWg.Wait()
 }
 
 func (l *LogForwarder) Stop() {
+	l.reloadMu.Lock()
+	l.stopped = true
+	l.reloadMu.Unlock()
+	atomic.StoreInt32(&l.running, 0)
 	if l.server != nil {
 		if err := l.server.Kill(); err != nil {
 			bslog.Errorf("[log forwarder] unable to kill server: %v", err)
 		}
 	}
+	if l.kubeStreamer != nil {
+		l.kubeStreamer.stop()
+	}
+	l.mu.RLock()
+	deduplicator, rateLimiter := l.deduplicator, l.rateLimiter
+	l.mu.RUnlock()
+	deduplicator.flush()
+	if rateLimiter != nil {
+		rateLimiter.stop()
+	}
+	if l.metrics != nil {
+		l.metrics.stop()
+	}
+	if l.infoClient != nil {
+		l.infoClient.StopWatchingEvents()
+	}
+	// Backends are stopped last, draining the messages still buffered in
+	// each forwarder.
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	for _, backend := range l.backends {
 		backend.stop()
 	}
-	if l.kubeStreamer != nil {
-		l.kubeStreamer.stop()
+}
+
+// Reload applies a new list of enabled backends. New backends are
+// initialized and removed ones are stopped, draining their buffers, while
+// backends still enabled are kept along with their buffered messages, being
+// reloaded if they support it or replaced if their settings changed. The
+// changes are only applied after every backend was prepared, nothing being
+// changed if any of them fails. The routing, redaction, rate limit and
+// deduplication settings are also applied.
+func (l *LogForwarder) Reload(enabledBackends []string) error {
+	l.reloadMu.Lock()
+	defer l.reloadMu.Unlock()
+	if l.stopped || atomic.LoadInt32(&l.running) == 0 {
+		return errors.New("log forwarder is not running")
 	}
+	disabled := len(enabledBackends) == 1 && enabledBackends[0] == noneBackend
+	if l.server == nil {
+		if disabled {
+			return nil
+		}
+		return errors.New("bs must be restarted to enable log backends")
+	}
+	if disabled {
+		enabledBackends = nil
+	}
+	router, err := newLogRouter()
+	if err != nil {
+		return err
+	}
+	redactor, err := newLogRedactor()
+	if err != nil {
+		return err
+	}
+	l.mu.RLock()
+	current := make(map[string]logBackend, len(l.backends))
+	for i, backend := range l.backends {
+		current[l.backendNames[i]] = backend
+	}
+	l.mu.RUnlock()
+	changes, err := prepareBackends(enabledBackends, current)
+	if err != nil {
+		return err
+	}
+	backends := make([]logBackend, len(changes))
+	for i, change := range changes {
+		backends[i] = change.backend
+	}
+	rateLimiter := newLogRateLimiter()
+	deduplicator := newLogDeduplicator(l.forward)
+	l.mu.Lock()
+	l.backends = backends
+	l.backendNames = enabledBackends
+	l.router = router
+	l.redactor = redactor
+	prevRateLimiter, prevDeduplicator := l.rateLimiter, l.deduplicator
+	l.rateLimiter = rateLimiter
+	l.deduplicator = deduplicator
+	l.mu.Unlock()
+	for _, change := range changes {
+		change.apply()
+	}
+	rateLimiter.start(l.forward)
+	prevRateLimiter.stop()
+	prevRateLimiter.wait()
+	prevRateLimiter.report(l.forward)
+	prevDeduplicator.flush()
+	for name, backend := range current {
+		bslog.Warnf("[log forwarder] disabling log backend %s", name)
+		backend.stop()
+	}
+	return nil
+}
+
+// prepareBackends prepares the changes to the backends enabled on reload,
+// removing the ones kept enabled from current. If any backend fails, the
+// changes prepared so far are discarded.
+func prepareBackends(enabledBackends []string, current map[string]logBackend) (changes []*backendChange, err error) {
+	defer func() {
+		if err != nil {
+			for _, change := range changes {
+				change.cancel()
+			}
+			changes = nil
+		}
+	}()
+	for _, name := range enabledBackends {
+		backend := current[name]
+		var change *backendChange
+		if backend == nil {
+			constructor := logBackends[name]
+			if constructor == nil {
+				return changes, fmt.Errorf("invalid log backend: %s", name)
+			}
+			backend = constructor()
+			if err = backend.initialize(); err != nil {
+				return changes, fmt.Errorf("unable to initialize log backend %q: %s", name, err)
+			}
+			name := name
+			change = &backendChange{
+				backend: backend,
+				commit: func() {
+					bslog.Warnf("[log forwarder] enabling log backend %s", name)
+				},
+				discard: backend.stop,
+			}
+		} else if reloadable, ok := backend.(reloadableBackend); ok {
+			if change, err = reloadable.reload(); err != nil {
+				return changes, fmt.Errorf("unable to reload log backend %q: %s", name, err)
+			}
+		} else if restartable, ok := backend.(restartableBackend); ok && restartable.settingsChanged() {
+			if change, err = restartable.restart(); err != nil {
+				return changes, fmt.Errorf("unable to restart log backend %q: %s", name, err)
+			}
+			name, commit := name, change.commit
+			change.commit = func() {
+				bslog.Warnf("[log forwarder] restarting log backend %s to apply new settings", name)
+				commit()
+			}
+		} else {
+			change = &backendChange{backend: backend}
+		}
+		delete(current, name)
+		changes = append(changes, change)
+	}
+	return changes, nil
 }
 
 func (l *LogForwarder) stopWait() {
@@ -204,7 +704,9 @@ func (l *LogForwarder) stopWait() {
 
 func (l *LogForwarder) Handle(logParts format.LogParts, _ int64, err error) {
 	parts := logParts["parts"].(*rawLogParts)
+	receivedMessages.Inc()
 	if err != nil {
+		parseErrors.Inc()
 		bslog.Debugf("[log forwarder] ignored msg %v error processing: %s", parts, err)
 		return
 	}
@@ -214,21 +716,51 @@ func (l *LogForwarder) Handle(logParts format.LogParts, _ int64, err error) {
 		return
 	}
 	if parts.ts.IsZero() || len(parts.priority) == 0 {
+		invalidMessages.Inc()
 		bslog.Debugf("[log forwarder] invalid message %v", parts)
 		return
 	}
 	contStr := string(parts.container)
 	contData, err := l.infoClient.GetContainer(contStr, true, nil)
 	if err != nil {
+		unknownContainer.Inc()
 		bslog.Debugf("[log forwarder] error getting container %v for msg %v", contStr, parts)
 		return
 	}
-	for _, backend := range l.backends {
+	l.metrics.account(parts, contData)
+	l.mu.RLock()
+	deduplicator, rateLimiter, redactor := l.deduplicator, l.rateLimiter, l.redactor
+	l.mu.RUnlock()
+	if !deduplicator.filter(parts, contData) {
+		deduplicatedMsgs.Inc()
+		return
+	}
+	if !rateLimiter.allow(contData) {
+		rateLimitedMessages.Inc()
+		return
+	}
+	redactor.redact(parts, contData)
+	l.forward(parts, contData)
+}
+
+// forward sends the log entry to the backends selected by the routing rules.
+func (l *LogForwarder) forward(parts *rawLogParts, contData *container.Container) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	rule := l.router.route(parts, contData)
+	if rule != nil && rule.Drop {
+		ruleDroppedMessages.Inc()
+		return
+	}
+	for i, backend := range l.backends {
 		if !contData.TsuruApp {
 			if _, ok := backend.(*tsuruBackend); ok {
 				continue
 			}
 		}
+		if rule != nil && !rule.allows(l.backendNames[i]) {
+			continue
+		}
 		backend.sendMessage(parts, contData)
 	}
 }
@@ -166,6 +166,202 @@ func (s *S) TestLogForwarderStartNoneBackend(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *S) TestLogForwarderReload(c *check.C) {
+	var udpConns []*net.UDPConn
+	for i := 0; i < 2; i++ {
+		addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+		c.Assert(err, check.IsNil)
+		udpConn, err := net.ListenUDP("udp", addr)
+		c.Assert(err, check.IsNil)
+		defer udpConn.Close()
+		udpConns = append(udpConns, udpConn)
+	}
+	os.Setenv("LOG_SYSLOG_FORWARD_ADDRESSES", "udp://"+udpConns[0].LocalAddr().String())
+	lf := LogForwarder{
+		BindAddress:     "udp://127.0.0.1:59317",
+		DockerEndpoint:  s.dockerServer.URL(),
+		EnabledBackends: []string{"syslog"},
+	}
+	err := lf.Start()
+	c.Assert(err, check.IsNil)
+	defer lf.stopWait()
+	backend := lf.backends[0].(*syslogBackend)
+	os.Setenv("LOG_SYSLOG_FORWARD_ADDRESSES", "udp://"+udpConns[1].LocalAddr().String())
+	err = lf.Reload([]string{"syslog", "gelf"})
+	c.Assert(err, check.IsNil)
+	c.Assert(lf.backendNames, check.DeepEquals, []string{"syslog", "gelf"})
+	c.Assert(lf.backends[0], check.Equals, backend)
+	c.Assert(backend.senders, check.HasLen, 1)
+	conn, err := net.Dial("udp", "127.0.0.1:59317")
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	msg := []byte(fmt.Sprintf("<30>2015-06-05T16:13:47Z myhost docker/%s: mymsg\n", s.id))
+	_, err = conn.Write(msg)
+	c.Assert(err, check.IsNil)
+	buffer := make([]byte, 1024)
+	err = udpConns[1].SetReadDeadline(time.Now().Add(2 * time.Second))
+	c.Assert(err, check.IsNil)
+	n, err := udpConns[1].Read(buffer)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(buffer[:n]), check.Equals, fmt.Sprintf("<30>Jun  5 13:13:47 %s coolappname[procx]: mymsg\n", s.idShort))
+	err = lf.Reload([]string{"invalid"})
+	c.Assert(err, check.ErrorMatches, "invalid log backend: invalid")
+	c.Assert(lf.backendNames, check.DeepEquals, []string{"syslog", "gelf"})
+	err = lf.Reload([]string{"none"})
+	c.Assert(err, check.IsNil)
+	c.Assert(lf.backends, check.HasLen, 0)
+	c.Assert(lf.Backends(), check.HasLen, 0)
+}
+
+func (s *S) TestLogForwarderReloadSettings(c *check.C) {
+	os.Setenv("LOG_GELF_HOST", "127.0.0.1:12201")
+	defer os.Unsetenv("LOG_GELF_HOST")
+	lf := LogForwarder{
+		BindAddress:     "udp://127.0.0.1:59317",
+		DockerEndpoint:  s.dockerServer.URL(),
+		EnabledBackends: []string{"syslog", "gelf"},
+	}
+	err := lf.Start()
+	c.Assert(err, check.IsNil)
+	defer lf.stopWait()
+	syslog := lf.backends[0]
+	gelf := lf.backends[1]
+	c.Assert(lf.router.rules, check.HasLen, 0)
+	c.Assert(lf.deduplicator.enabled, check.Equals, false)
+	err = lf.Reload([]string{"syslog", "gelf"})
+	c.Assert(err, check.IsNil)
+	c.Assert(lf.backends[0], check.Equals, syslog)
+	c.Assert(lf.backends[1], check.Equals, gelf)
+	os.Setenv("LOG_GELF_HOST", "127.0.0.1:12202")
+	os.Setenv("LOG_ROUTING_RULES", `[{"app": "noisy", "drop": true}]`)
+	defer os.Unsetenv("LOG_ROUTING_RULES")
+	os.Setenv("LOG_DEDUP_ENABLE", "true")
+	defer os.Unsetenv("LOG_DEDUP_ENABLE")
+	err = lf.Reload([]string{"syslog", "gelf"})
+	c.Assert(err, check.IsNil)
+	c.Assert(lf.backends[0], check.Equals, syslog)
+	c.Assert(lf.backends[1], check.Not(check.Equals), gelf)
+	c.Assert(lf.backends[1].(*gelfBackend).host, check.Equals, "127.0.0.1:12202")
+	c.Assert(lf.router.rules, check.HasLen, 1)
+	c.Assert(lf.deduplicator.enabled, check.Equals, true)
+	os.Setenv("LOG_ROUTING_RULES", `[{"severity": "bogus"}]`)
+	err = lf.Reload([]string{"syslog", "gelf"})
+	c.Assert(err, check.ErrorMatches, `invalid routing rule 0: .*`)
+	c.Assert(lf.router.rules, check.HasLen, 1)
+}
+
+func (s *S) TestLogForwarderReloadRollback(c *check.C) {
+	os.Setenv("LOG_SYSLOG_FORWARD_ADDRESSES", "udp://127.0.0.1:1514")
+	lf := LogForwarder{
+		BindAddress:     "udp://127.0.0.1:59317",
+		DockerEndpoint:  s.dockerServer.URL(),
+		EnabledBackends: []string{"syslog"},
+	}
+	err := lf.Start()
+	c.Assert(err, check.IsNil)
+	defer lf.stopWait()
+	backend := lf.backends[0].(*syslogBackend)
+	os.Setenv("LOG_SYSLOG_FORWARD_ADDRESSES", "udp://127.0.0.1:1515")
+	os.Setenv("LOG_ROUTING_RULES", `[{"app": "noisy", "drop": true}]`)
+	defer os.Unsetenv("LOG_ROUTING_RULES")
+	err = lf.Reload([]string{"syslog", "gelf", "invalid"})
+	c.Assert(err, check.ErrorMatches, "invalid log backend: invalid")
+	c.Assert(lf.backendNames, check.DeepEquals, []string{"syslog"})
+	c.Assert(lf.backends[0], check.Equals, backend)
+	c.Assert(backend.addrs, check.DeepEquals, []string{"udp://127.0.0.1:1514"})
+	c.Assert(lf.router.rules, check.HasLen, 0)
+	c.Assert(backendShardStats("syslog"), check.HasLen, 1)
+	c.Assert(backendShardStats("gelf"), check.HasLen, 0)
+}
+
+func (s *S) TestLogForwarderReloadRestartKeepsBuffer(c *check.C) {
+	os.Setenv("LOG_GELF_HOST", "127.0.0.1:12201")
+	defer os.Unsetenv("LOG_GELF_HOST")
+	lf := LogForwarder{
+		BindAddress:     "udp://127.0.0.1:59317",
+		DockerEndpoint:  s.dockerServer.URL(),
+		EnabledBackends: []string{"gelf"},
+	}
+	err := lf.Start()
+	c.Assert(err, check.IsNil)
+	defer lf.stopWait()
+	prev := lf.backends[0].(*gelfBackend).sender
+	os.Setenv("LOG_GELF_HOST", "127.0.0.1:12202")
+	err = lf.Reload([]string{"gelf"})
+	c.Assert(err, check.IsNil)
+	next := lf.backends[0].(*gelfBackend).sender
+	c.Assert(next, check.Not(check.Equals), prev)
+	c.Assert(next.chans[0], check.Equals, prev.chans[0])
+	c.Assert(backendShardStats("gelf"), check.HasLen, 1)
+}
+
+func (s *S) TestLogForwarderReloadAfterStop(c *check.C) {
+	lf := LogForwarder{
+		BindAddress:     "udp://127.0.0.1:59317",
+		DockerEndpoint:  s.dockerServer.URL(),
+		EnabledBackends: []string{"syslog"},
+	}
+	err := lf.Start()
+	c.Assert(err, check.IsNil)
+	lf.Stop()
+	err = lf.Reload([]string{"syslog", "gelf"})
+	c.Assert(err, check.ErrorMatches, "log forwarder is not running")
+	c.Assert(lf.backendNames, check.DeepEquals, []string{"syslog"})
+	lf.Wait()
+}
+
+func (s *S) TestLogForwarderReloadSyslogRestartWarning(c *check.C) {
+	prevLog := bslog.Logger
+	logBuf := bytes.NewBuffer(nil)
+	bslog.Logger = log.New(logBuf, "", 0)
+	defer func() {
+		bslog.Logger = prevLog
+	}()
+	lf := LogForwarder{
+		BindAddress:     "udp://127.0.0.1:59317",
+		DockerEndpoint:  s.dockerServer.URL(),
+		EnabledBackends: []string{"syslog"},
+	}
+	err := lf.Start()
+	c.Assert(err, check.IsNil)
+	defer lf.stopWait()
+	os.Setenv("LOG_SYSLOG_TIMEZONE", "America/Grenada")
+	defer os.Unsetenv("LOG_SYSLOG_TIMEZONE")
+	c.Assert(lf.Reload([]string{"syslog"}), check.IsNil)
+	c.Assert(lf.Reload([]string{"syslog"}), check.IsNil)
+	c.Assert(strings.Count(logBuf.String(), "syslog settings changed, restart bs to apply them: LOG_SYSLOG_TIMEZONE"), check.Equals, 1)
+}
+
+func (s *S) TestEnvSnapshotChangedSettings(c *check.C) {
+	os.Setenv("LOG_GELF_HOST", "localhost:12201")
+	defer os.Unsetenv("LOG_GELF_HOST")
+	os.Setenv("LOG_BUFFER_SIZE", "100")
+	defer os.Unsetenv("LOG_BUFFER_SIZE")
+	snapshot := takeEnvSnapshot("LOG_GELF_", "LOG_BUFFER_SIZE")
+	c.Assert(snapshot.settingsChanged(), check.Equals, false)
+	os.Setenv("LOG_GELF_HOST", "localhost:12202")
+	os.Setenv("LOG_GELF_WORKERS", "2")
+	defer os.Unsetenv("LOG_GELF_WORKERS")
+	os.Unsetenv("LOG_BUFFER_SIZE")
+	os.Setenv("LOG_BUFFER_SIZE_OTHER", "1")
+	defer os.Unsetenv("LOG_BUFFER_SIZE_OTHER")
+	c.Assert(snapshot.settingsChanged(), check.Equals, true)
+	c.Assert(snapshot.changedSettings(), check.DeepEquals, []string{"LOG_BUFFER_SIZE", "LOG_GELF_HOST", "LOG_GELF_WORKERS"})
+}
+
+func (s *S) TestLogForwarderReloadNoneBackend(c *check.C) {
+	lf := LogForwarder{
+		BindAddress:     "udp://127.0.0.1:59317",
+		DockerEndpoint:  s.dockerServer.URL(),
+		EnabledBackends: []string{"none"},
+	}
+	err := lf.Start()
+	c.Assert(err, check.IsNil)
+	defer lf.stopWait()
+	c.Assert(lf.Reload([]string{"none"}), check.IsNil)
+	c.Assert(lf.Reload([]string{"syslog"}), check.ErrorMatches, "bs must be restarted to enable log backends")
+}
+
 func (s *S) TestLogForwarderStartWithTimezone(c *check.C) {
 	os.Setenv("LOG_SYSLOG_TIMEZONE", "America/Grenada")
 	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
@@ -843,7 +1039,7 @@ func BenchmarkMessagesWaitOneSyslogAddress(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		lf.Handle(parts, 1, nil)
 	}
-	close(lf.backends[0].(*syslogBackend).msgChans[0])
+	close(lf.backends[0].(*syslogBackend).senders[0].chans[0])
 	<-done[0]
 	b.StopTimer()
 	if err = lf.server.Kill(); err != nil {
@@ -883,8 +1079,8 @@ func BenchmarkMessagesWaitTwoSyslogAddresses(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		lf.Handle(parts, 1, nil)
 	}
-	close(lf.backends[0].(*syslogBackend).msgChans[0])
-	close(lf.backends[0].(*syslogBackend).msgChans[1])
+	close(lf.backends[0].(*syslogBackend).senders[0].chans[0])
+	close(lf.backends[0].(*syslogBackend).senders[1].chans[0])
 	<-done[0]
 	<-done[1]
 	b.StopTimer()
@@ -1053,7 +1249,7 @@ func BenchmarkMessagesBroadcastWaitTsuru(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		lf.Handle(parts, 1, nil)
 	}
-	close(lf.backends[0].(*tsuruBackend).msgCh)
+	close(lf.backends[0].(*tsuruBackend).sender.chans[0])
 	<-done
 	b.StopTimer()
 }
@@ -1090,6 +1286,50 @@ func (s *S) TestGelfForwarder(c *check.C) {
 	c.Assert(gelfMsg.Extra["_pid"], check.Equals, "procx")
 }
 
+func (s *S) TestGelfBackendProcessBytesSent(c *check.C) {
+	defer os.Unsetenv("LOG_GELF_HOST")
+	reader, err := gelf.NewReader("127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	os.Setenv("LOG_GELF_HOST", reader.Addr())
+	b := &gelfBackend{}
+	b.setup()
+	conn, err := b.connect()
+	c.Assert(err, check.IsNil)
+	defer b.close(conn)
+	msg := &gelf.Message{Version: "1.1", Host: "myhost", Short: "mymsg", Extra: map[string]interface{}{}}
+	var encoded bytes.Buffer
+	c.Assert(msg.MarshalJSONBuf(&encoded), check.IsNil)
+	sent := b.bytesSent.Value()
+	c.Assert(b.process(conn, msg), check.IsNil)
+	c.Assert(b.bytesSent.Value()-sent, check.Equals, uint64(encoded.Len()))
+	gelfMsg, err := reader.ReadMessage()
+	c.Assert(err, check.IsNil)
+	c.Assert(gelfMsg.Short, check.Equals, "mymsg")
+}
+
+func (s *S) TestGelfBackendProcessBytesSentChunked(c *check.C) {
+	defer os.Unsetenv("LOG_GELF_HOST")
+	reader, err := gelf.NewReader("127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	os.Setenv("LOG_GELF_HOST", reader.Addr())
+	b := &gelfBackend{}
+	b.setup()
+	b.chunkSize = 100
+	conn, err := b.connect()
+	c.Assert(err, check.IsNil)
+	defer b.close(conn)
+	msg := &gelf.Message{Version: "1.1", Host: "myhost", Short: strings.Repeat("x", 500), Extra: map[string]interface{}{}}
+	var encoded bytes.Buffer
+	c.Assert(msg.MarshalJSONBuf(&encoded), check.IsNil)
+	chunks := (encoded.Len() + 87) / 88
+	sent := b.bytesSent.Value()
+	c.Assert(b.process(conn, msg), check.IsNil)
+	c.Assert(b.bytesSent.Value()-sent, check.Equals, uint64(encoded.Len()+chunks*gelfChunkHeaderLen))
+	gelfMsg, err := reader.ReadMessage()
+	c.Assert(err, check.IsNil)
+	c.Assert(gelfMsg.Short, check.Equals, strings.Repeat("x", 500))
+}
+
 func (s *S) TestGelfForwarderExtraTags(c *check.C) {
 	defer os.Unsetenv("LOG_GELF_HOST")
 	defer os.Unsetenv("LOG_GELF_EXTRA_TAGS")
@@ -1318,7 +1558,7 @@ func BenchmarkMessagesGelfBackendProcess(b *testing.B) {
 		}
 	}
 	b.StopTimer()
-	close(be.quitCh)
+	be.sender.stop()
 	stopWg.Wait()
 }
 
@@ -1366,7 +1606,7 @@ func BenchmarkMessagesWaitOneGelfBackend(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		lf.Handle(parts, 1, nil)
 	}
-	close(lf.backends[0].(*gelfBackend).msgCh)
+	close(lf.backends[0].(*gelfBackend).sender.chans[0])
 	stopWg.Wait()
 	b.StopTimer()
 	lf.stopWait()
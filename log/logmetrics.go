@@ -0,0 +1,314 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tsuru/bs/bslog"
+	"github.com/tsuru/bs/config"
+	"github.com/tsuru/bs/container"
+	"github.com/tsuru/bs/metric"
+)
+
+const (
+	extractorCounter   = "counter"
+	extractorHistogram = "histogram"
+)
+
+var (
+	severityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+	defaultHistogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// metricExtractor derives a metric from log entries, either counting entries
+// matching Pattern or observing the value of a key=value Field (or of the
+// first capture group in Pattern) in a histogram.
+type metricExtractor struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Field   string    `json:"field"`
+	Pattern string    `json:"pattern"`
+	Buckets []float64 `json:"buckets"`
+
+	re     *regexp.Regexp
+	fields map[string]string
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+type appLogMetrics struct {
+	info       metric.ContainerInfo
+	lines      uint64
+	bytes      uint64
+	severities [8]uint64
+	counters   map[string]uint64
+	histograms map[string]*histogram
+}
+
+type logMetrics struct {
+	mu         sync.Mutex
+	backend    metric.Backend
+	interval   time.Duration
+	extractors []metricExtractor
+	apps       map[string]*appLogMetrics
+	quit       chan struct{}
+	done       chan struct{}
+	stopOnce   sync.Once
+}
+
+func parseMetricExtractors(data []byte) ([]metricExtractor, error) {
+	var extractors []metricExtractor
+	err := json.Unmarshal(data, &extractors)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse metric extractors: %s", err)
+	}
+	for i := range extractors {
+		err = extractors[i].compile()
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric extractor %q: %s", extractors[i].Name, err)
+		}
+	}
+	return extractors, nil
+}
+
+func (e *metricExtractor) compile() error {
+	if e.Name == "" {
+		return fmt.Errorf("name must be set")
+	}
+	if (e.Field == "") == (e.Pattern == "") {
+		return fmt.Errorf("exactly one of field or pattern must be set")
+	}
+	if e.Pattern != "" {
+		var err error
+		e.re, err = regexp.Compile(e.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %s", e.Pattern, err)
+		}
+	} else {
+		e.fields = map[string]string{e.Field: ""}
+	}
+	switch e.Type {
+	case extractorCounter:
+	case extractorHistogram:
+		if e.re != nil && e.re.NumSubexp() == 0 {
+			return fmt.Errorf("histogram pattern must have a capture group")
+		}
+		if len(e.Buckets) == 0 {
+			e.Buckets = defaultHistogramBuckets
+		}
+		sort.Float64s(e.Buckets)
+	default:
+		return fmt.Errorf("invalid type %q", e.Type)
+	}
+	return nil
+}
+
+// extract returns the value found in content, ok is false if the extractor
+// doesn't apply to it.
+func (e *metricExtractor) extract(content []byte) (value float64, ok bool) {
+	var raw string
+	if e.re != nil {
+		match := e.re.FindSubmatch(content)
+		if match == nil {
+			return 0, false
+		}
+		if e.Type == extractorCounter {
+			return 1, true
+		}
+		raw = string(match[1])
+	} else {
+		_, raw, _, ok = nextField(string(content), e.fields)
+		if !ok {
+			return 0, false
+		}
+		if e.Type == extractorCounter {
+			return 1, true
+		}
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// newLogMetrics returns nil if log metrics are disabled.
+func newLogMetrics() (*logMetrics, error) {
+	if !config.BoolEnvOrDefault(false, "LOG_METRICS_ENABLE") {
+		return nil, nil
+	}
+	backend, err := metric.Get(config.Config.MetricsBackend)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize log metrics: %s", err)
+	}
+	m := &logMetrics{
+		backend:  backend,
+		interval: config.Config.MetricsInterval,
+		apps:     make(map[string]*appLogMetrics),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	extractors := config.StringEnvOrDefault("", "LOG_METRICS_EXTRACTORS")
+	if extractors != "" {
+		m.extractors, err = parseMetricExtractors([]byte(extractors))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// extracted is a value found by a metric extractor in a log entry.
+type extracted struct {
+	extractor *metricExtractor
+	value     float64
+}
+
+func (m *logMetrics) account(parts *rawLogParts, c *container.Container) {
+	if m == nil {
+		return
+	}
+	var values []extracted
+	for i := range m.extractors {
+		e := &m.extractors[i]
+		if value, ok := e.extract(parts.content); ok {
+			values = append(values, extracted{extractor: e, value: value})
+		}
+	}
+	severity, hasSeverity := parts.severity()
+	key := appKey(c) + "/" + c.ProcessName
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	app := m.apps[key]
+	if app == nil {
+		var name string
+		if c.Name != "" {
+			name = c.Name[1:]
+		}
+		app = &appLogMetrics{
+			info: metric.ContainerInfo{
+				Name:     name,
+				Hostname: c.ShortHostname,
+				App:      c.AppName,
+				Process:  c.ProcessName,
+				Image:    c.Config.Image,
+			},
+			counters:   make(map[string]uint64),
+			histograms: make(map[string]*histogram),
+		}
+		m.apps[key] = app
+	}
+	app.lines++
+	app.bytes += uint64(len(parts.content))
+	if hasSeverity {
+		app.severities[severity]++
+	}
+	for _, v := range values {
+		e := v.extractor
+		if e.Type == extractorCounter {
+			app.counters[e.Name]++
+			continue
+		}
+		h := app.histograms[e.Name]
+		if h == nil {
+			h = &histogram{buckets: e.Buckets, counts: make([]uint64, len(e.Buckets))}
+			app.histograms[e.Name] = h
+		}
+		h.observe(v.value)
+	}
+}
+
+func (m *logMetrics) collect() map[string]*appLogMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	apps := m.apps
+	m.apps = make(map[string]*appLogMetrics)
+	return apps
+}
+
+func (app *appLogMetrics) values() map[string]interface{} {
+	values := map[string]interface{}{
+		"log_lines": metric.Float(float64(app.lines)),
+		"log_bytes": metric.Float(float64(app.bytes)),
+	}
+	for i, n := range app.severities {
+		if n > 0 {
+			values["log_lines_"+severityNames[i]] = metric.Float(float64(n))
+		}
+	}
+	for name, n := range app.counters {
+		values["log_"+name] = metric.Float(float64(n))
+	}
+	for name, h := range app.histograms {
+		values["log_"+name+"_count"] = metric.Float(float64(h.count))
+		values["log_"+name+"_sum"] = metric.Float(h.sum)
+		for i, b := range h.buckets {
+			le := strconv.FormatFloat(b, 'f', -1, 64)
+			values["log_"+name+"_bucket_"+le] = metric.Float(float64(h.counts[i]))
+		}
+	}
+	return values
+}
+
+func (m *logMetrics) send() {
+	for _, app := range m.collect() {
+		for key, value := range app.values() {
+			err := m.backend.Send(app.info, key, value)
+			if err != nil {
+				bslog.Errorf("[log metrics] failed to send metric %s for app %q: %s", key, app.info.App, err)
+				break
+			}
+		}
+	}
+}
+
+// start sends the accumulated log metrics to the metric backend every
+// interval.
+func (m *logMetrics) start() {
+	go func() {
+		defer close(m.done)
+		for {
+			select {
+			case <-m.quit:
+				return
+			case <-time.After(m.interval):
+			}
+			m.send()
+		}
+	}()
+}
+
+func (m *logMetrics) stop() {
+	m.stopOnce.Do(func() {
+		close(m.quit)
+	})
+}
+
+func (m *logMetrics) wait() {
+	<-m.done
+}
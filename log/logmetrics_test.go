@@ -0,0 +1,131 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"os"
+	"sync"
+
+	"github.com/tsuru/bs/config"
+	"github.com/tsuru/bs/metric"
+	"gopkg.in/check.v1"
+)
+
+type fakeMetricBackend struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+func (b *fakeMetricBackend) Send(container metric.ContainerInfo, key string, value interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.values[container.App+"/"+container.Process+":"+key] = value
+	return nil
+}
+
+func (b *fakeMetricBackend) SendConn(container metric.ContainerInfo, host string) error {
+	return nil
+}
+
+func (b *fakeMetricBackend) SendHost(host metric.HostInfo, key string, value interface{}) error {
+	return nil
+}
+
+var logFakeMetricBackend = fakeMetricBackend{values: map[string]interface{}{}}
+
+func init() {
+	metric.Register("logfake", func() (metric.Backend, error) {
+		return &logFakeMetricBackend, nil
+	})
+}
+
+func (s *S) TestParseMetricExtractorsInvalid(c *check.C) {
+	tests := []struct {
+		extractors string
+		err        string
+	}{
+		{extractors: `{}`, err: `unable to parse metric extractors: .*`},
+		{extractors: `[{"type": "counter", "pattern": "x"}]`, err: `invalid metric extractor "": name must be set`},
+		{extractors: `[{"name": "a", "type": "counter"}]`, err: `invalid metric extractor "a": exactly one of field or pattern must be set`},
+		{extractors: `[{"name": "a", "type": "counter", "pattern": "("}]`, err: `invalid metric extractor "a": invalid pattern .*`},
+		{extractors: `[{"name": "a", "type": "histogram", "pattern": "x"}]`, err: `invalid metric extractor "a": histogram pattern must have a capture group`},
+		{extractors: `[{"name": "a", "type": "gauge", "field": "x"}]`, err: `invalid metric extractor "a": invalid type "gauge"`},
+	}
+	for _, tt := range tests {
+		_, err := parseMetricExtractors([]byte(tt.extractors))
+		c.Check(err, check.ErrorMatches, tt.err)
+	}
+}
+
+func (s *S) TestNewLogMetricsDisabled(c *check.C) {
+	m, err := newLogMetrics()
+	c.Assert(err, check.IsNil)
+	c.Assert(m, check.IsNil)
+	m.account(&rawLogParts{}, routingContainer("myapp", "web", nil))
+}
+
+func (s *S) TestLogMetricsSend(c *check.C) {
+	os.Setenv("LOG_METRICS_ENABLE", "true")
+	os.Setenv("LOG_METRICS_EXTRACTORS", `[
+		{"name": "request_time", "type": "histogram", "field": "request_time", "buckets": [1, 0.1]},
+		{"name": "took", "type": "histogram", "pattern": "took (\\d+)ms", "buckets": [100]},
+		{"name": "timeouts", "type": "counter", "pattern": "timeout"}
+	]`)
+	defer os.Unsetenv("LOG_METRICS_ENABLE")
+	defer os.Unsetenv("LOG_METRICS_EXTRACTORS")
+	defer func(backend string) { config.Config.MetricsBackend = backend }(config.Config.MetricsBackend)
+	config.Config.MetricsBackend = "logfake"
+	logFakeMetricBackend.values = map[string]interface{}{}
+	m, err := newLogMetrics()
+	c.Assert(err, check.IsNil)
+	cont := routingContainer("myapp", "web", nil)
+	for _, p := range []*rawLogParts{
+		{priority: []byte("30"), content: []byte("GET / request_time=0.05 status=200")},
+		{priority: []byte("30"), content: []byte("GET / request_time=0.5 status=200")},
+		{priority: []byte("27"), content: []byte("request timeout took 200ms")},
+		{priority: []byte("30"), content: []byte("request_time=abc took 5ms")},
+	} {
+		m.account(p, cont)
+	}
+	m.account(&rawLogParts{priority: []byte("30"), content: []byte("ok")}, routingContainer("otherapp", "worker", nil))
+	m.send()
+	c.Assert(logFakeMetricBackend.values, check.DeepEquals, map[string]interface{}{
+		"myapp/web:log_lines":                   metric.Float(4),
+		"myapp/web:log_bytes":                   metric.Float(118),
+		"myapp/web:log_lines_info":              metric.Float(3),
+		"myapp/web:log_lines_err":               metric.Float(1),
+		"myapp/web:log_timeouts":                metric.Float(1),
+		"myapp/web:log_request_time_count":      metric.Float(2),
+		"myapp/web:log_request_time_sum":        metric.Float(0.55),
+		"myapp/web:log_request_time_bucket_0.1": metric.Float(1),
+		"myapp/web:log_request_time_bucket_1":   metric.Float(2),
+		"myapp/web:log_took_count":              metric.Float(2),
+		"myapp/web:log_took_sum":                metric.Float(205),
+		"myapp/web:log_took_bucket_100":         metric.Float(1),
+		"otherapp/worker:log_lines":             metric.Float(1),
+		"otherapp/worker:log_bytes":             metric.Float(2),
+		"otherapp/worker:log_lines_info":        metric.Float(1),
+	})
+	c.Assert(m.collect(), check.HasLen, 0)
+}
+
+func (s *S) TestLogMetricsWithoutAppName(c *check.C) {
+	m := &logMetrics{apps: make(map[string]*appLogMetrics)}
+	cont1 := routingContainer("", "", nil)
+	cont1.ID = "cont1"
+	cont1.Name = "/cont1"
+	cont2 := routingContainer("", "", nil)
+	cont2.ID = "cont2"
+	cont2.Name = "/cont2"
+	m.account(&rawLogParts{content: []byte("a")}, cont1)
+	m.account(&rawLogParts{content: []byte("b")}, cont2)
+	m.account(&rawLogParts{content: []byte("c")}, cont1)
+	apps := m.collect()
+	c.Assert(apps, check.HasLen, 2)
+	c.Assert(apps["cont1/"].info.Name, check.Equals, "cont1")
+	c.Assert(apps["cont1/"].lines, check.Equals, uint64(2))
+	c.Assert(apps["cont2/"].info.Name, check.Equals, "cont2")
+	c.Assert(apps["cont2/"].lines, check.Equals, uint64(1))
+}
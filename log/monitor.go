@@ -14,6 +14,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -221,10 +222,19 @@ func logEntryFromName(fileName string) logFileEntry {
 	return entry
 }
 
+// MonitorState describes a Kubernetes container log file being streamed.
+type MonitorState struct {
+	ContainerID string
+	Path        string
+	Alive       bool
+	LastTime    time.Time
+}
+
 type kubernetesLogStreamer struct {
 	dir      string
 	posDir   string
 	quit     chan struct{}
+	mu       sync.Mutex
 	monitors map[string]*fileMonitor
 	handler  syslog.Handler
 	client   *container.InfoClient
@@ -258,7 +268,30 @@ func (s *kubernetesLogStreamer) stop() {
 	s.quit <- struct{}{}
 }
 
+func (s *kubernetesLogStreamer) states() []MonitorState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]MonitorState, 0, len(s.monitors))
+	for id, m := range s.monitors {
+		st := MonitorState{
+			ContainerID: id,
+			Path:        m.path,
+			Alive:       m.alive(),
+		}
+		if t := atomic.LoadInt64(&m.lastTime); t > 0 {
+			st.LastTime = time.Unix(0, t)
+		}
+		states = append(states, st)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].ContainerID < states[j].ContainerID
+	})
+	return states
+}
+
 func (s *kubernetesLogStreamer) watchOnce() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for id, m := range s.monitors {
 		_, err := os.Stat(m.path)
 		if err != nil && os.IsNotExist(err) {
@@ -314,6 +347,8 @@ func (s *kubernetesLogStreamer) watch() {
 		select {
 		case <-time.After(time.Second):
 		case <-s.quit:
+			s.mu.Lock()
+			defer s.mu.Unlock()
 			for _, m := range s.monitors {
 				m.stop()
 				if err := m.wait(); err != nil {
@@ -323,6 +323,30 @@ func (s *S) TestKubernetesLogStreamerWatch(c *check.C) {
 	})
 }
 
+func (s *S) TestKubernetesLogStreamerStates(c *check.C) {
+	dirName, err := ioutil.TempDir("", "bs-kube-log")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dirName)
+	srv, cli := serverWithClient(c)
+	defer srv.Stop()
+	th := &testHandler{parts: make(chan format.LogParts)}
+	streamer, err := newKubeLogStreamer(th, cli, dirName, dirName)
+	c.Assert(err, check.IsNil)
+	c.Assert(streamer.states(), check.HasLen, 0)
+	go streamer.watch()
+	defer streamer.stop()
+	name := filepath.Join(dirName, "myapp-web-2453793373-cbk0k_default_myapp-web-e50ac4567691092729a360a3a8fdc9741e81030dd3f8e90633c71cba88e32f6b.log")
+	err = ioutil.WriteFile(name, []byte(singleEntry), 0600)
+	c.Assert(err, check.IsNil)
+	partsTimeout(c, th.parts)
+	states := streamer.states()
+	c.Assert(states, check.HasLen, 1)
+	c.Assert(states[0].ContainerID, check.Equals, "e50ac4567691092729a360a3a8fdc9741e81030dd3f8e90633c71cba88e32f6b")
+	c.Assert(states[0].Path, check.Equals, name)
+	ts0, _ := time.Parse(time.RFC3339, "2017-03-21T21:28:52Z")
+	c.Assert(states[0].LastTime.Equal(ts0), check.Equals, true)
+}
+
 func (s *S) TestKubernetesLogStreamerWatchCreatesPosDir(c *check.C) {
 	dirName, err := ioutil.TempDir("", "bs-kube-log")
 	c.Assert(err, check.IsNil)
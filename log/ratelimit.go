@@ -0,0 +1,255 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"fmt"
+	stdSyslog "log/syslog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tsuru/bs/bslog"
+	"github.com/tsuru/bs/config"
+	"github.com/tsuru/bs/container"
+)
+
+const (
+	rateLimitLabel      = "bs.tsuru.io/log-rate-limit"
+	rateLimitBurstLabel = "bs.tsuru.io/log-rate-limit-burst"
+)
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type rateLimitBucket struct {
+	bucket    tokenBucket
+	dropped   uint64
+	lastSeen  time.Time
+	container *container.Container
+}
+
+// logRateLimiter applies a token bucket rate limit for each app (or each app
+// process), messages exceeding the limit are dropped and periodically
+// reported back in the app log stream.
+type logRateLimiter struct {
+	mu             sync.Mutex
+	rate           int
+	burst          int
+	byProcess      bool
+	reportInterval time.Duration
+	buckets        map[string]*rateLimitBucket
+	lastPrune      time.Time
+	now            func() time.Time
+	quit           chan struct{}
+	done           chan struct{}
+	stopOnce       sync.Once
+}
+
+// rateLimitIdleTimeout is how long a bucket without messages is kept when
+// drop reports are disabled.
+const rateLimitIdleTimeout = time.Minute
+
+type rateLimitDrop struct {
+	container *container.Container
+	dropped   uint64
+	rate      float64
+}
+
+func newLogRateLimiter() *logRateLimiter {
+	return &logRateLimiter{
+		rate:           config.IntEnvOrDefault(0, "LOG_RATE_LIMIT"),
+		burst:          config.IntEnvOrDefault(0, "LOG_RATE_LIMIT_BURST"),
+		byProcess:      config.BoolEnvOrDefault(false, "LOG_RATE_LIMIT_BY_PROCESS"),
+		reportInterval: config.SecondsEnvOrDefault(60, "LOG_RATE_LIMIT_REPORT_INTERVAL"),
+		buckets:        make(map[string]*rateLimitBucket),
+		now:            time.Now,
+		quit:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+}
+
+func (l *logRateLimiter) limitFor(c *container.Container) (rate, burst int) {
+	rate, burst = l.rate, l.burst
+	if val, ok := c.GetLabelAny(rateLimitLabel); ok {
+		if v, err := strconv.Atoi(val); err == nil {
+			rate = v
+		}
+	}
+	if val, ok := c.GetLabelAny(rateLimitBurstLabel); ok {
+		if v, err := strconv.Atoi(val); err == nil {
+			burst = v
+		}
+	}
+	if burst < rate {
+		burst = rate
+	}
+	return rate, burst
+}
+
+func (l *logRateLimiter) key(c *container.Container) string {
+	key := appKey(c)
+	if l.byProcess {
+		return key + "/" + c.ProcessName
+	}
+	return key
+}
+
+// appKey returns the app name of the container, falling back to its ID for
+// containers not belonging to an app, so they don't share the same key.
+func appKey(c *container.Container) string {
+	if c.AppName == "" {
+		return c.ID
+	}
+	return c.AppName
+}
+
+// allow reports whether a message from the container is within its rate
+// limit, accounting the message as dropped otherwise.
+func (l *logRateLimiter) allow(c *container.Container) bool {
+	if l == nil {
+		return true
+	}
+	rate, burst := l.limitFor(c)
+	if rate <= 0 {
+		return true
+	}
+	now := l.now()
+	key := l.key(c)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pruneIdle(now)
+	b := l.buckets[key]
+	if b == nil || b.bucket.rate != float64(rate) || b.bucket.burst != float64(burst) {
+		b = &rateLimitBucket{bucket: tokenBucket{
+			rate:   float64(rate),
+			burst:  float64(burst),
+			tokens: float64(burst),
+		}}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	b.container = c
+	if b.bucket.take(now) {
+		return true
+	}
+	b.dropped++
+	return false
+}
+
+// pruneIdle forgets, at most once per idle timeout, the buckets without
+// recent activity and without drops waiting to be reported, so buckets are
+// pruned even when drop reports are disabled. It must be called with l.mu
+// held.
+func (l *logRateLimiter) pruneIdle(now time.Time) {
+	idle := l.reportInterval
+	if idle <= 0 {
+		idle = rateLimitIdleTimeout
+	}
+	if now.Sub(l.lastPrune) < idle {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) <= idle {
+			continue
+		}
+		if b.dropped == 0 || l.reportInterval <= 0 {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// collectDrops returns and resets the dropped messages count for each rate
+// limited key, also forgetting keys without recent activity.
+func (l *logRateLimiter) collectDrops() []rateLimitDrop {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var drops []rateLimitDrop
+	for key, b := range l.buckets {
+		if b.dropped > 0 {
+			drops = append(drops, rateLimitDrop{
+				container: b.container,
+				dropped:   b.dropped,
+				rate:      b.bucket.rate,
+			})
+			b.dropped = 0
+		} else if now.Sub(b.lastSeen) > l.reportInterval {
+			delete(l.buckets, key)
+		}
+	}
+	return drops
+}
+
+func (l *logRateLimiter) dropParts(drop rateLimitDrop) *rawLogParts {
+	pr := int((stdSyslog.LOG_DAEMON & facilityMask) | (stdSyslog.LOG_WARNING & severityMask))
+	return &rawLogParts{
+		ts:        l.now(),
+		priority:  []byte(strconv.Itoa(pr)),
+		container: []byte(drop.container.ID),
+		content: []byte(fmt.Sprintf("bs: %d log lines dropped in the last %v due to rate limit of %v lines/s",
+			drop.dropped, l.reportInterval, drop.rate)),
+	}
+}
+
+// start periodically injects, in the stream of each rate limited app, an
+// entry reporting how many messages were dropped.
+func (l *logRateLimiter) start(send func(*rawLogParts, *container.Container)) {
+	if l.reportInterval <= 0 {
+		close(l.done)
+		return
+	}
+	go func() {
+		defer close(l.done)
+		ticker := time.NewTicker(l.reportInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.quit:
+				return
+			case <-ticker.C:
+			}
+			l.report(send)
+		}
+	}()
+}
+
+// report injects the drop reports collected since the last report.
+func (l *logRateLimiter) report(send func(*rawLogParts, *container.Container)) {
+	for _, drop := range l.collectDrops() {
+		bslog.Warnf("[log forwarder] dropped %d log messages from app %q due to rate limit", drop.dropped, drop.container.AppName)
+		send(l.dropParts(drop), drop.container)
+	}
+}
+
+func (l *logRateLimiter) stop() {
+	l.stopOnce.Do(func() {
+		close(l.quit)
+	})
+}
+
+func (l *logRateLimiter) wait() {
+	<-l.done
+}
@@ -0,0 +1,161 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLogRateLimiterAllow(c *check.C) {
+	os.Setenv("LOG_RATE_LIMIT", "2")
+	defer os.Unsetenv("LOG_RATE_LIMIT")
+	limiter := newLogRateLimiter()
+	now := time.Date(2015, 6, 5, 16, 13, 47, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	cont := routingContainer("myapp", "web", nil)
+	other := routingContainer("otherapp", "web", nil)
+	c.Assert(limiter.allow(cont), check.Equals, true)
+	c.Assert(limiter.allow(cont), check.Equals, true)
+	c.Assert(limiter.allow(cont), check.Equals, false)
+	c.Assert(limiter.allow(cont), check.Equals, false)
+	c.Assert(limiter.allow(other), check.Equals, true)
+	now = now.Add(500 * time.Millisecond)
+	c.Assert(limiter.allow(cont), check.Equals, true)
+	c.Assert(limiter.allow(cont), check.Equals, false)
+	drops := limiter.collectDrops()
+	c.Assert(drops, check.HasLen, 1)
+	c.Assert(drops[0].container, check.Equals, cont)
+	c.Assert(drops[0].dropped, check.Equals, uint64(3))
+	c.Assert(drops[0].rate, check.Equals, float64(2))
+	c.Assert(limiter.collectDrops(), check.HasLen, 0)
+	c.Assert(limiter.buckets, check.HasLen, 2)
+	now = now.Add(2 * time.Minute)
+	c.Assert(limiter.collectDrops(), check.HasLen, 0)
+	c.Assert(limiter.buckets, check.HasLen, 0)
+}
+
+func (s *S) TestLogRateLimiterPruneWithoutReports(c *check.C) {
+	os.Setenv("LOG_RATE_LIMIT", "1")
+	os.Setenv("LOG_RATE_LIMIT_REPORT_INTERVAL", "0")
+	defer os.Unsetenv("LOG_RATE_LIMIT")
+	defer os.Unsetenv("LOG_RATE_LIMIT_REPORT_INTERVAL")
+	limiter := newLogRateLimiter()
+	now := time.Date(2015, 6, 5, 16, 13, 47, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	cont := routingContainer("myapp", "web", nil)
+	c.Assert(limiter.allow(cont), check.Equals, true)
+	c.Assert(limiter.allow(cont), check.Equals, false)
+	for i := 0; i < 10; i++ {
+		c.Assert(limiter.allow(routingContainer(fmt.Sprintf("app%d", i), "web", nil)), check.Equals, true)
+	}
+	c.Assert(limiter.buckets, check.HasLen, 11)
+	now = now.Add(30 * time.Second)
+	c.Assert(limiter.allow(cont), check.Equals, true)
+	c.Assert(limiter.buckets, check.HasLen, 11)
+	now = now.Add(rateLimitIdleTimeout)
+	c.Assert(limiter.allow(cont), check.Equals, true)
+	c.Assert(limiter.buckets, check.HasLen, 1)
+}
+
+func (s *S) TestLogRateLimiterPruneKeepsUnreportedDrops(c *check.C) {
+	os.Setenv("LOG_RATE_LIMIT", "1")
+	defer os.Unsetenv("LOG_RATE_LIMIT")
+	limiter := newLogRateLimiter()
+	now := time.Date(2015, 6, 5, 16, 13, 47, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	cont := routingContainer("myapp", "web", nil)
+	c.Assert(limiter.allow(cont), check.Equals, true)
+	c.Assert(limiter.allow(cont), check.Equals, false)
+	c.Assert(limiter.allow(routingContainer("otherapp", "web", nil)), check.Equals, true)
+	now = now.Add(2 * time.Minute)
+	c.Assert(limiter.allow(routingContainer("newapp", "web", nil)), check.Equals, true)
+	c.Assert(limiter.buckets, check.HasLen, 2)
+	drops := limiter.collectDrops()
+	c.Assert(drops, check.HasLen, 1)
+	c.Assert(drops[0].container, check.Equals, cont)
+}
+
+func (s *S) TestLogRateLimiterLabelOverride(c *check.C) {
+	limiter := newLogRateLimiter()
+	now := time.Date(2015, 6, 5, 16, 13, 47, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	cont := routingContainer("myapp", "web", map[string]string{
+		rateLimitLabel:      "1",
+		rateLimitBurstLabel: "3",
+	})
+	for i := 0; i < 3; i++ {
+		c.Assert(limiter.allow(cont), check.Equals, true)
+	}
+	c.Assert(limiter.allow(cont), check.Equals, false)
+	unlimited := routingContainer("otherapp", "web", nil)
+	for i := 0; i < 10; i++ {
+		c.Assert(limiter.allow(unlimited), check.Equals, true)
+	}
+}
+
+func (s *S) TestLogRateLimiterByProcess(c *check.C) {
+	os.Setenv("LOG_RATE_LIMIT", "1")
+	os.Setenv("LOG_RATE_LIMIT_BY_PROCESS", "true")
+	defer os.Unsetenv("LOG_RATE_LIMIT")
+	defer os.Unsetenv("LOG_RATE_LIMIT_BY_PROCESS")
+	limiter := newLogRateLimiter()
+	c.Assert(limiter.allow(routingContainer("myapp", "web", nil)), check.Equals, true)
+	c.Assert(limiter.allow(routingContainer("myapp", "worker", nil)), check.Equals, true)
+	c.Assert(limiter.allow(routingContainer("myapp", "web", nil)), check.Equals, false)
+}
+
+func (s *S) TestLogRateLimiterWithoutAppName(c *check.C) {
+	os.Setenv("LOG_RATE_LIMIT", "1")
+	defer os.Unsetenv("LOG_RATE_LIMIT")
+	limiter := newLogRateLimiter()
+	cont1 := routingContainer("", "", nil)
+	cont1.ID = "cont1"
+	cont2 := routingContainer("", "", nil)
+	cont2.ID = "cont2"
+	c.Assert(limiter.allow(cont1), check.Equals, true)
+	c.Assert(limiter.allow(cont2), check.Equals, true)
+	c.Assert(limiter.allow(cont1), check.Equals, false)
+	c.Assert(limiter.buckets, check.HasLen, 2)
+}
+
+func (s *S) TestLogForwarderRateLimitReport(c *check.C) {
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	udpConn, err := net.ListenUDP("udp", addr)
+	c.Assert(err, check.IsNil)
+	os.Setenv("LOG_SYSLOG_FORWARD_ADDRESSES", "udp://"+udpConn.LocalAddr().String())
+	os.Setenv("LOG_RATE_LIMIT", "1")
+	os.Setenv("LOG_RATE_LIMIT_REPORT_INTERVAL", "0.5")
+	lf := LogForwarder{
+		BindAddress:     "udp://127.0.0.1:59317",
+		DockerEndpoint:  s.dockerServer.URL(),
+		EnabledBackends: []string{"syslog"},
+	}
+	err = lf.Start()
+	c.Assert(err, check.IsNil)
+	defer lf.stopWait()
+	conn, err := net.Dial("udp", "127.0.0.1:59317")
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		msg := []byte(fmt.Sprintf("<30>2015-06-05T16:13:47Z myhost docker/%s: mymsg %d\n", s.id, i))
+		_, err = conn.Write(msg)
+		c.Assert(err, check.IsNil)
+	}
+	buffer := make([]byte, 1024)
+	err = udpConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	c.Assert(err, check.IsNil)
+	n, err := udpConn.Read(buffer)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(buffer[:n]), check.Equals, fmt.Sprintf("<30>Jun  5 13:13:47 %s coolappname[procx]: mymsg 0\n", s.idShort))
+	n, err = udpConn.Read(buffer)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(buffer[:n]), check.Matches, fmt.Sprintf(`<28>\w+ +\d+ [\d:]+ %s coolappname\[procx\]: bs: 2 log lines dropped in the last 500ms due to rate limit of 1 lines/s\n`, s.idShort))
+}
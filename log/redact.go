@@ -0,0 +1,203 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/tsuru/bs/config"
+	"github.com/tsuru/bs/container"
+)
+
+// redactDetector finds sensitive data in log messages. When the expression
+// has capture groups only the first participating group is masked, allowing
+// the surrounding context (e.g. "password=") to be kept.
+type redactDetector struct {
+	name  string
+	re    *regexp.Regexp
+	valid func([]byte) bool
+}
+
+var builtinDetectors = map[string]redactDetector{
+	"creditCard": {
+		re:    regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		valid: cardValid,
+	},
+	"jwt": {
+		re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+`),
+	},
+	"authorization": {
+		re: regexp.MustCompile(`(?i)authorization:\s*(?:(?:bearer|basic|token)\s+)?(\S+)`),
+	},
+	"awsKey": {
+		re: regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b|(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})`),
+	},
+}
+
+type logRedactor struct {
+	detectors []redactDetector
+	mask      []byte
+}
+
+// cardNetwork describes the numbers issued by a card network: their
+// prefixes, given as inclusive ranges, and the valid lengths.
+type cardNetwork struct {
+	prefixes [][2]int
+	lengths  []int
+}
+
+var cardNetworks = []cardNetwork{
+	{prefixes: [][2]int{{4, 4}}, lengths: []int{13, 16, 19}},
+	{prefixes: [][2]int{{51, 55}, {2221, 2720}}, lengths: []int{16}},
+	{prefixes: [][2]int{{34, 34}, {37, 37}}, lengths: []int{15}},
+	{prefixes: [][2]int{{6011, 6011}, {65, 65}, {644, 649}}, lengths: []int{16, 17, 18, 19}},
+}
+
+// cardValid reports whether data, ignoring separators, has the prefix and
+// length of a card network and passes the Luhn check, so other long numbers,
+// like timestamps, are not taken as card numbers.
+func cardValid(data []byte) bool {
+	var digits []byte
+	for _, ch := range data {
+		if ch >= '0' && ch <= '9' {
+			digits = append(digits, ch)
+		}
+	}
+	for _, network := range cardNetworks {
+		if network.matches(digits) {
+			return luhnValid(digits)
+		}
+	}
+	return false
+}
+
+func (n *cardNetwork) matches(digits []byte) bool {
+	var validLength bool
+	for _, l := range n.lengths {
+		if len(digits) == l {
+			validLength = true
+			break
+		}
+	}
+	if !validLength {
+		return false
+	}
+	for _, r := range n.prefixes {
+		size := len(strconv.Itoa(r[0]))
+		prefix, err := strconv.Atoi(string(digits[:size]))
+		if err == nil && prefix >= r[0] && prefix <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func luhnValid(data []byte) bool {
+	var sum, n int
+	for i := len(data) - 1; i >= 0; i-- {
+		ch := data[i]
+		if ch < '0' || ch > '9' {
+			continue
+		}
+		digit := int(ch - '0')
+		if n%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
+
+// newLogRedactor returns nil if redaction is disabled.
+func newLogRedactor() (*logRedactor, error) {
+	if !config.BoolEnvOrDefault(false, "LOG_REDACT_ENABLE") {
+		return nil, nil
+	}
+	r := &logRedactor{
+		mask: []byte(config.StringEnvOrDefault("[REDACTED]", "LOG_REDACT_MASK")),
+	}
+	names := config.StringsEnvOrDefault([]string{"creditCard", "jwt", "authorization", "awsKey"}, "LOG_REDACT_DETECTORS")
+	for _, name := range names {
+		d, ok := builtinDetectors[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid redact detector: %s", name)
+		}
+		d.name = name
+		r.detectors = append(r.detectors, d)
+	}
+	patterns := config.StringEnvOrDefault("", "LOG_REDACT_PATTERNS")
+	if patterns != "" {
+		var exprs []string
+		err := json.Unmarshal([]byte(patterns), &exprs)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse redact patterns: %s", err)
+		}
+		for i, expr := range exprs {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redact pattern %q: %s", expr, err)
+			}
+			r.detectors = append(r.detectors, redactDetector{name: fmt.Sprintf("pattern%d", i), re: re})
+		}
+	}
+	return r, nil
+}
+
+func (d *redactDetector) redact(content, mask []byte) ([]byte, int) {
+	matches := d.re.FindAllSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return content, 0
+	}
+	var out []byte
+	var last, count int
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		for i := 2; i < len(m); i += 2 {
+			if m[i] >= 0 {
+				start, end = m[i], m[i+1]
+				break
+			}
+		}
+		if d.valid != nil && !d.valid(content[start:end]) {
+			continue
+		}
+		out = append(out, content[last:start]...)
+		out = append(out, mask...)
+		last = end
+		count++
+	}
+	if count == 0 {
+		return content, 0
+	}
+	return append(out, content[last:]...), count
+}
+
+// redact replaces sensitive data in the entry content with the configured
+// mask, accounting the number of redactions for the container app.
+func (r *logRedactor) redact(parts *rawLogParts, c *container.Container) {
+	if r == nil {
+		return
+	}
+	var total int
+	for i := range r.detectors {
+		var n int
+		parts.content, n = r.detectors[i].redact(parts.content, r.mask)
+		total += n
+	}
+	if total == 0 {
+		return
+	}
+	redactions.Add(uint64(total))
+	if c.AppName != "" {
+		appRedactions(c.AppName).Add(uint64(total))
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/tsuru/bs/bslog"
+	"github.com/tsuru/bs/config"
+	"github.com/tsuru/bs/container"
+)
+
+const routingRulesLabel = "bs.tsuru.io/log-rules"
+
+// routingRule decides which backends receive the log entries matching all of
+// its non-empty conditions. A rule either drops the entry or restricts the
+// set of backends receiving it, an empty Backends list means every enabled
+// backend.
+type routingRule struct {
+	App      string            `json:"app"`
+	Process  string            `json:"process"`
+	Labels   map[string]string `json:"labels"`
+	Severity string            `json:"severity"`
+	Content  string            `json:"content"`
+	Backends []string          `json:"backends"`
+	Drop     bool              `json:"drop"`
+
+	severity  int
+	contentRe *regexp.Regexp
+}
+
+type routingRules []routingRule
+
+type logRouter struct {
+	rules      routingRules
+	labelRules *lru.Cache
+}
+
+func parseRoutingRules(data []byte) (routingRules, error) {
+	var rules routingRules
+	err := json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse routing rules: %s", err)
+	}
+	for i := range rules {
+		err = rules[i].compile()
+		if err != nil {
+			return nil, fmt.Errorf("invalid routing rule %d: %s", i, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *routingRule) compile() error {
+	r.severity = -1
+	if r.Severity != "" {
+		r.severity = int(parseMsgLevel(r.Severity))
+		if r.severity < 0 {
+			return fmt.Errorf("unknown severity %q", r.Severity)
+		}
+	}
+	if r.Content != "" {
+		var err error
+		r.contentRe, err = regexp.Compile(r.Content)
+		if err != nil {
+			return fmt.Errorf("invalid content regexp %q: %s", r.Content, err)
+		}
+	}
+	if r.Drop && len(r.Backends) > 0 {
+		return fmt.Errorf("drop and backends are mutually exclusive")
+	}
+	for _, name := range r.Backends {
+		if logBackends[name] == nil {
+			return fmt.Errorf("invalid log backend: %s", name)
+		}
+	}
+	return nil
+}
+
+func (r *routingRule) match(parts *rawLogParts, c *container.Container) bool {
+	if r.App != "" && r.App != c.AppName {
+		return false
+	}
+	if r.Process != "" && r.Process != c.ProcessName {
+		return false
+	}
+	for k, v := range r.Labels {
+		if label, ok := c.GetLabelAny(k); !ok || label != v {
+			return false
+		}
+	}
+	if r.severity >= 0 {
+		severity, ok := parts.severity()
+		if !ok || severity > r.severity {
+			return false
+		}
+	}
+	if r.contentRe != nil && !r.contentRe.Match(parts.content) {
+		return false
+	}
+	return true
+}
+
+func (r *routingRule) allows(backendName string) bool {
+	if len(r.Backends) == 0 {
+		return true
+	}
+	for _, name := range r.Backends {
+		if name == backendName {
+			return true
+		}
+	}
+	return false
+}
+
+func newLogRouter() (*logRouter, error) {
+	router := &logRouter{}
+	var err error
+	router.labelRules, err = lru.New(100)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(config.StringEnvOrDefault("", "LOG_ROUTING_RULES"))
+	if rulesFile := config.StringEnvOrDefault("", "LOG_ROUTING_RULES_FILE"); rulesFile != "" {
+		data, err = ioutil.ReadFile(rulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read routing rules file: %s", err)
+		}
+	}
+	if len(data) > 0 {
+		router.rules, err = parseRoutingRules(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return router, nil
+}
+
+// route returns the first rule matching the log entry, rules set in the
+// container labels take precedence over the global ones. A nil rule means
+// the entry must be sent to every backend.
+func (r *logRouter) route(parts *rawLogParts, c *container.Container) *routingRule {
+	if r == nil {
+		return nil
+	}
+	if raw, ok := c.GetLabelAny(routingRulesLabel); ok {
+		rules := r.containerRules(raw)
+		for i := range rules {
+			if rules[i].match(parts, c) {
+				return &rules[i]
+			}
+		}
+	}
+	for i := range r.rules {
+		if r.rules[i].match(parts, c) {
+			return &r.rules[i]
+		}
+	}
+	return nil
+}
+
+func (r *logRouter) containerRules(raw string) routingRules {
+	if val, ok := r.labelRules.Get(raw); ok {
+		return val.(routingRules)
+	}
+	rules, err := parseRoutingRules([]byte(raw))
+	if err != nil {
+		bslog.Warnf("[log forwarder] ignoring rules in label %s: %s", routingRulesLabel, err)
+	}
+	r.labelRules.Add(raw, rules)
+	return rules
+}
@@ -0,0 +1,158 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/bs/container"
+	"gopkg.in/check.v1"
+)
+
+func routingContainer(app, process string, labels map[string]string) *container.Container {
+	return &container.Container{
+		Container:   docker.Container{Config: &docker.Config{Labels: labels}},
+		AppName:     app,
+		ProcessName: process,
+	}
+}
+
+func (s *S) TestParseRoutingRulesInvalid(c *check.C) {
+	tests := []struct {
+		rules string
+		err   string
+	}{
+		{rules: `{}`, err: `unable to parse routing rules: .*`},
+		{rules: `[{"severity": "bogus"}]`, err: `invalid routing rule 0: unknown severity "bogus"`},
+		{rules: `[{}, {"content": "("}]`, err: `invalid routing rule 1: invalid content regexp "\(": .*`},
+		{rules: `[{"drop": true, "backends": ["tsuru"]}]`, err: `invalid routing rule 0: drop and backends are mutually exclusive`},
+		{rules: `[{"backends": ["splunk"]}]`, err: `invalid routing rule 0: invalid log backend: splunk`},
+	}
+	for _, tt := range tests {
+		_, err := parseRoutingRules([]byte(tt.rules))
+		c.Check(err, check.ErrorMatches, tt.err)
+	}
+}
+
+func (s *S) TestLogRouterRoute(c *check.C) {
+	os.Setenv("LOG_ROUTING_RULES", `[
+		{"app": "payments", "severity": "error", "backends": ["gelf"]},
+		{"app": "payments", "drop": true},
+		{"content": "GET /healthcheck", "drop": true},
+		{"labels": {"team": "core"}, "backends": ["syslog"]}
+	]`)
+	defer os.Unsetenv("LOG_ROUTING_RULES")
+	router, err := newLogRouter()
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		parts    *rawLogParts
+		cont     *container.Container
+		expected int
+	}{
+		{
+			parts:    &rawLogParts{priority: []byte("27"), content: []byte("failed")},
+			cont:     routingContainer("payments", "web", nil),
+			expected: 0,
+		},
+		{
+			parts:    &rawLogParts{priority: []byte("30"), content: []byte("ok")},
+			cont:     routingContainer("payments", "web", nil),
+			expected: 1,
+		},
+		{
+			parts:    &rawLogParts{priority: []byte("30"), content: []byte(`"GET /healthcheck HTTP/1.1" 200`)},
+			cont:     routingContainer("myapp", "web", nil),
+			expected: 2,
+		},
+		{
+			parts:    &rawLogParts{priority: []byte("30"), content: []byte("ok")},
+			cont:     routingContainer("myapp", "web", map[string]string{"team": "core"}),
+			expected: 3,
+		},
+		{
+			parts:    &rawLogParts{priority: []byte("30"), content: []byte("ok")},
+			cont:     routingContainer("myapp", "web", map[string]string{"team": "other"}),
+			expected: -1,
+		},
+	}
+	for i, tt := range tests {
+		rule := router.route(tt.parts, tt.cont)
+		if tt.expected == -1 {
+			c.Check(rule, check.IsNil, check.Commentf("test %d", i))
+			continue
+		}
+		c.Check(rule, check.Equals, &router.rules[tt.expected], check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestLogRouterRouteContainerLabels(c *check.C) {
+	os.Setenv("LOG_ROUTING_RULES", `[{"app": "myapp", "backends": ["tsuru"]}]`)
+	defer os.Unsetenv("LOG_ROUTING_RULES")
+	router, err := newLogRouter()
+	c.Assert(err, check.IsNil)
+	cont := routingContainer("myapp", "web", map[string]string{
+		routingRulesLabel: `[{"process": "worker", "drop": true}]`,
+	})
+	rule := router.route(&rawLogParts{priority: []byte("30")}, cont)
+	c.Assert(rule, check.Equals, &router.rules[0])
+	cont.ProcessName = "worker"
+	rule = router.route(&rawLogParts{priority: []byte("30")}, cont)
+	c.Assert(rule, check.NotNil)
+	c.Assert(rule.Drop, check.Equals, true)
+	cont.Config.Labels[routingRulesLabel] = "invalid"
+	rule = router.route(&rawLogParts{priority: []byte("30")}, cont)
+	c.Assert(rule, check.Equals, &router.rules[0])
+}
+
+func (s *S) TestLogRouterRulesFile(c *check.C) {
+	f, err := ioutil.TempFile("", "routing")
+	c.Assert(err, check.IsNil)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`[{"app": "myapp", "drop": true}]`)
+	c.Assert(err, check.IsNil)
+	f.Close()
+	os.Setenv("LOG_ROUTING_RULES_FILE", f.Name())
+	defer os.Unsetenv("LOG_ROUTING_RULES_FILE")
+	router, err := newLogRouter()
+	c.Assert(err, check.IsNil)
+	c.Assert(router.rules, check.HasLen, 1)
+	c.Assert(router.rules[0].App, check.Equals, "myapp")
+}
+
+func (s *S) TestLogForwarderHandleRoutingDrop(c *check.C) {
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	udpConn, err := net.ListenUDP("udp", addr)
+	c.Assert(err, check.IsNil)
+	os.Setenv("LOG_SYSLOG_FORWARD_ADDRESSES", "udp://"+udpConn.LocalAddr().String())
+	os.Setenv("LOG_ROUTING_RULES", `[{"app": "coolappname", "content": "^health", "drop": true}]`)
+	lf := LogForwarder{
+		BindAddress:     "udp://127.0.0.1:59317",
+		DockerEndpoint:  s.dockerServer.URL(),
+		EnabledBackends: []string{"syslog"},
+	}
+	err = lf.Start()
+	c.Assert(err, check.IsNil)
+	defer lf.stopWait()
+	conn, err := net.Dial("udp", "127.0.0.1:59317")
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	for _, content := range []string{"healthcheck ok", "mymsg"} {
+		msg := []byte(fmt.Sprintf("<30>2015-06-05T16:13:47Z myhost docker/%s: %s\n", s.id, content))
+		_, err = conn.Write(msg)
+		c.Assert(err, check.IsNil)
+	}
+	buffer := make([]byte, 1024)
+	err = udpConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	c.Assert(err, check.IsNil)
+	n, err := udpConn.Read(buffer)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(buffer[:n]), check.Equals, fmt.Sprintf("<30>Jun  5 13:13:47 %s coolappname[procx]: mymsg\n", s.idShort))
+}
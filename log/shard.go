@@ -0,0 +1,278 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// shardStats describes the buffer of a single shard of a log forwarder.
+type shardStats struct {
+	Backend   string
+	Forwarder string
+	Shard     int
+	Buffered  int
+	Capacity  int
+	Dropped   uint64
+}
+
+// ForwarderState describes a single forwarder of a log backend, its circuit
+// and its buffer.
+type ForwarderState struct {
+	Name      string
+	Circuit   string
+	Failures  int
+	LastError string
+	Buffered  int
+	Capacity  int
+	Dropped   uint64
+}
+
+// BackendState describes an enabled log backend and its forwarders.
+type BackendState struct {
+	Name       string
+	Forwarders []ForwarderState
+}
+
+var shardedSenders = struct {
+	sync.Mutex
+	m map[*shardedSender]struct{}
+}{m: make(map[*shardedSender]struct{})}
+
+// shardedSender distributes messages among a number of forwarders, each one
+// with its own connection and buffer. Messages are sharded by key, usually
+// the app name, so the ordering of messages with the same key is preserved.
+type shardedSender struct {
+	backend   string
+	name      string
+	telemetry *backendTelemetry
+	names     []string
+	chans     []chan LogMessage
+	workers   []*forwarderWorker
+	dropped   []uint64
+	start     chan struct{}
+}
+
+func backendForwarderStates(backend string) []ForwarderState {
+	shardedSenders.Lock()
+	defer shardedSenders.Unlock()
+	var states []ForwarderState
+	for s := range shardedSenders.m {
+		if s.backend == backend {
+			states = append(states, s.states()...)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+	return states
+}
+
+func backendShardStats(backend string) []shardStats {
+	shardedSenders.Lock()
+	defer shardedSenders.Unlock()
+	var stats []shardStats
+	for s := range shardedSenders.m {
+		if s.backend == backend {
+			stats = append(stats, s.stats()...)
+		}
+	}
+	return stats
+}
+
+// newShardedSender starts workers forwarders for backend, created by
+// newForwarder, splitting bufferSize among them. When replacing prev, the
+// forwarders only send messages after taking over prev, reusing its buffers
+// if the number of shards and their size are the same.
+func newShardedSender(backend string, workers, bufferSize int, newForwarder func() forwarderBackend, prev *shardedSender) (*shardedSender, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	shardBufferSize := bufferSize / workers
+	if bufferSize > 0 && shardBufferSize == 0 {
+		shardBufferSize = 1
+	}
+	s := &shardedSender{
+		backend:   backend,
+		telemetry: newBackendTelemetry(backend),
+		dropped:   make([]uint64, workers),
+	}
+	reuse := prev != nil && len(prev.chans) == workers && cap(prev.chans[0]) == shardBufferSize
+	if prev != nil {
+		s.start = make(chan struct{})
+	}
+	for i := 0; i < workers; i++ {
+		forwarder := newForwarder()
+		name := forwarderName(forwarder)
+		if i == 0 {
+			s.name = name
+		}
+		if workers > 1 {
+			name = fmt.Sprintf("%s [shard %d]", name, i)
+		}
+		ch := make(chan LogMessage, shardBufferSize)
+		if reuse {
+			ch = prev.chans[i]
+		}
+		worker, err := startForwarder(forwarder, name, &forwarderTelemetry{
+			backendTelemetry: s.telemetry,
+			shardDropped:     &s.dropped[i],
+		}, ch, s.start)
+		if err != nil {
+			s.abandon()
+			return nil, err
+		}
+		s.names = append(s.names, name)
+		s.chans = append(s.chans, ch)
+		s.workers = append(s.workers, worker)
+	}
+	if prev == nil {
+		s.register()
+	}
+	return s, nil
+}
+
+func (s *shardedSender) register() {
+	shardedSenders.Lock()
+	shardedSenders.m[s] = struct{}{}
+	shardedSenders.Unlock()
+	for i := range s.chans {
+		registerShardGauge(s.backend, i)
+	}
+}
+
+func (s *shardedSender) unregister() {
+	shardedSenders.Lock()
+	delete(shardedSenders.m, s)
+	shardedSenders.Unlock()
+}
+
+// takeOver stops the forwarders of prev, keeping their buffered messages,
+// which are moved to the buffers of s unless they're shared, and starts
+// sending messages through the forwarders of s. Messages not fitting in the
+// new buffers are dropped.
+func (s *shardedSender) takeOver(prev *shardedSender) {
+	prev.unregister()
+	for _, worker := range prev.workers {
+		worker.stop(false)
+	}
+	for _, worker := range prev.workers {
+		<-worker.done
+	}
+	for i, ch := range prev.chans {
+		target := i % len(s.chans)
+		if s.chans[target] == ch {
+			continue
+		}
+	move:
+		for {
+			select {
+			case msg := <-ch:
+				select {
+				case s.chans[target] <- msg:
+				default:
+					atomic.AddUint64(&s.dropped[target], 1)
+					s.telemetry.dropped.Inc()
+				}
+			default:
+				break move
+			}
+		}
+	}
+	s.register()
+	close(s.start)
+}
+
+// abandon stops the forwarders of a sender which never took over its
+// predecessor, leaving the buffered messages in place.
+func (s *shardedSender) abandon() {
+	s.unregister()
+	for _, worker := range s.workers {
+		worker.stop(false)
+	}
+}
+
+// replaceSender returns the change replacing a backend using prev by backend,
+// using next.
+func replaceSender(backend logBackend, prev, next *shardedSender) *backendChange {
+	return &backendChange{
+		backend: backend,
+		commit: func() {
+			next.takeOver(prev)
+		},
+		discard: next.abandon,
+	}
+}
+
+func (s *shardedSender) shard(key string) int {
+	if len(s.chans) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(s.chans)))
+}
+
+// send enqueues msg in the shard for key, returning false if the shard
+// buffer is full and the message was dropped.
+func (s *shardedSender) send(key string, msg LogMessage) bool {
+	i := s.shard(key)
+	select {
+	case s.chans[i] <- msg:
+		return true
+	default:
+		atomic.AddUint64(&s.dropped[i], 1)
+		s.telemetry.dropped.Inc()
+		return false
+	}
+}
+
+func (s *shardedSender) stats() []shardStats {
+	stats := make([]shardStats, len(s.chans))
+	for i, ch := range s.chans {
+		stats[i] = shardStats{
+			Backend:   s.backend,
+			Forwarder: s.name,
+			Shard:     i,
+			Buffered:  len(ch),
+			Capacity:  cap(ch),
+			Dropped:   atomic.LoadUint64(&s.dropped[i]),
+		}
+	}
+	return stats
+}
+
+func (s *shardedSender) states() []ForwarderState {
+	states := make([]ForwarderState, len(s.chans))
+	for i, ch := range s.chans {
+		states[i] = ForwarderState{
+			Name:     s.names[i],
+			Circuit:  circuitClosed.String(),
+			Buffered: len(ch),
+			Capacity: cap(ch),
+			Dropped:  atomic.LoadUint64(&s.dropped[i]),
+		}
+		if breaker := circuitFor(s.names[i]); breaker != nil {
+			state, failures, lastErr := breaker.snapshot()
+			states[i].Circuit = state.String()
+			states[i].Failures = failures
+			if lastErr != nil {
+				states[i].LastError = lastErr.Error()
+			}
+		}
+	}
+	return states
+}
+
+func (s *shardedSender) stop() {
+	s.unregister()
+	for _, worker := range s.workers {
+		worker.stop(true)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tsuru/bs/container"
+	"github.com/tsuru/bs/telemetry"
+	"gopkg.in/check.v1"
+)
+
+type namedFakeForwarder struct {
+	fakeForwarder
+	name string
+}
+
+func (f *namedFakeForwarder) String() string {
+	return f.name
+}
+
+func (s *S) TestShardedSender(c *check.C) {
+	var forwarders []*namedFakeForwarder
+	sender, err := newShardedSender("fake", 3, 300, func() forwarderBackend {
+		f := &namedFakeForwarder{name: "fake shards"}
+		forwarders = append(forwarders, f)
+		return f
+	}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(forwarders, check.HasLen, 3)
+	c.Assert(sender.shard("myapp"), check.Equals, sender.shard("myapp"))
+	apps := []string{"app1", "app2", "app3", "app4", "app5", "app6"}
+	for i := 0; i < 10; i++ {
+		for _, app := range apps {
+			c.Assert(sender.send(app, fmt.Sprintf("%s %d", app, i)), check.Equals, true)
+		}
+	}
+	stats := sender.stats()
+	c.Assert(stats, check.HasLen, 3)
+	for i, st := range stats {
+		c.Assert(st.Forwarder, check.Equals, "fake shards")
+		c.Assert(st.Shard, check.Equals, i)
+		c.Assert(st.Capacity, check.Equals, 100)
+	}
+	for _, name := range []string{"fake shards [shard 0]", "fake shards [shard 2]"} {
+		b := circuitFor(name)
+		c.Assert(b, check.NotNil)
+		c.Assert(b.State(), check.Equals, circuitClosed)
+	}
+	sender.stop()
+	timeout := time.After(5 * time.Second)
+	for _, f := range forwarders {
+		for {
+			f.mu.Lock()
+			closed := f.closed
+			f.mu.Unlock()
+			if closed > 0 {
+				break
+			}
+			select {
+			case <-timeout:
+				c.Fatal("timeout waiting for shards to stop")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	var total int
+	for _, f := range forwarders {
+		seen := map[string]int{}
+		for _, msg := range f.processed {
+			var app string
+			var n int
+			fmt.Sscanf(msg.(string), "%s %d", &app, &n)
+			if last, ok := seen[app]; ok {
+				c.Assert(n, check.Equals, last+1)
+			}
+			seen[app] = n
+			total++
+		}
+	}
+	c.Assert(total, check.Equals, 60)
+}
+
+func (s *S) TestShardedSenderDropped(c *check.C) {
+	f := &namedFakeForwarder{name: "fake dropped"}
+	sender, err := newShardedSender("fake", 1, 1, func() forwarderBackend {
+		return f
+	}, nil)
+	c.Assert(err, check.IsNil)
+	defer sender.stop()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var dropped bool
+	for i := 0; i < 5; i++ {
+		if !sender.send("myapp", "msg") {
+			dropped = true
+		}
+	}
+	c.Assert(dropped, check.Equals, true)
+	var found bool
+	for _, st := range backendShardStats("fake") {
+		if st.Forwarder == "fake dropped" {
+			found = true
+			c.Assert(st.Dropped > 0, check.Equals, true)
+			c.Assert(st.Capacity, check.Equals, 1)
+		}
+	}
+	c.Assert(found, check.Equals, true)
+}
+
+func (s *S) TestShardedSenderShardGauges(c *check.C) {
+	f := &namedFakeForwarder{name: "fake gauges"}
+	sender, err := newShardedSender("fakegauges", 2, 10, func() forwarderBackend {
+		return f
+	}, nil)
+	c.Assert(err, check.IsNil)
+	defer sender.stop()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sender.chans[1] <- "msg"
+	snapshot := telemetry.Snapshot()
+	c.Assert(snapshot["bs_log_fakegauges_shard0_buffered"], check.Equals, float64(0))
+	c.Assert(snapshot["bs_log_fakegauges_shard1_buffered"], check.Equals, float64(1))
+}
+
+func (s *S) TestLogForwarderBackendsState(c *check.C) {
+	f := &namedFakeForwarder{name: "fake state"}
+	sender, err := newShardedSender("fakestate", 2, 10, func() forwarderBackend {
+		return f
+	}, nil)
+	c.Assert(err, check.IsNil)
+	defer sender.stop()
+	lf := LogForwarder{backendNames: []string{"fakestate"}, running: 1}
+	c.Assert(lf.Healthy(), check.IsNil)
+	backends := lf.Backends()
+	c.Assert(backends, check.HasLen, 1)
+	c.Assert(backends[0].Name, check.Equals, "fakestate")
+	c.Assert(backends[0].Forwarders, check.HasLen, 2)
+	c.Assert(backends[0].Forwarders[0].Name, check.Equals, "fake state [shard 0]")
+	c.Assert(backends[0].Forwarders[0].Circuit, check.Equals, "closed")
+	c.Assert(backends[0].Forwarders[1].Capacity, check.Equals, 5)
+	breaker := circuitFor("fake state [shard 1]")
+	c.Assert(breaker, check.NotNil)
+	for i := 0; i < breaker.threshold; i++ {
+		breaker.failure(errors.New("connection refused"))
+	}
+	backends = lf.Backends()
+	c.Assert(backends[0].Forwarders[1].Circuit, check.Equals, "open")
+	c.Assert(backends[0].Forwarders[1].Failures, check.Equals, breaker.threshold)
+	c.Assert(backends[0].Forwarders[1].LastError, check.Equals, "connection refused")
+	c.Assert(lf.Healthy(), check.ErrorMatches, `circuit open for fake state \[shard 1\]: connection refused`)
+}
+
+func (s *S) TestLogForwarderNotRunningIsUnhealthy(c *check.C) {
+	lf := LogForwarder{}
+	c.Assert(lf.Healthy(), check.ErrorMatches, "syslog server is not running")
+	c.Assert(lf.Backends(), check.HasLen, 0)
+	c.Assert(lf.KubernetesMonitors(), check.HasLen, 0)
+}
+
+func (s *S) TestShardKeyWithoutAppName(c *check.C) {
+	cont := &container.Container{AppName: "myapp"}
+	cont.ID = "cont1"
+	c.Assert(appKey(cont), check.Equals, "myapp")
+	cont.AppName = ""
+	c.Assert(appKey(cont), check.Equals, "cont1")
+}
+
+func (s *S) TestShardedSenderTakeOver(c *check.C) {
+	prevForwarder := &namedFakeForwarder{name: "fake takeover"}
+	prev, err := newShardedSender("fake", 1, 10, func() forwarderBackend {
+		return prevForwarder
+	}, nil)
+	c.Assert(err, check.IsNil)
+	prevForwarder.mu.Lock()
+	for _, msg := range []string{"a", "b", "c"} {
+		c.Assert(prev.send("myapp", msg), check.Equals, true)
+	}
+	var forwarders []*namedFakeForwarder
+	next, err := newShardedSender("fake", 2, 10, func() forwarderBackend {
+		f := &namedFakeForwarder{name: "fake takeover next"}
+		forwarders = append(forwarders, f)
+		return f
+	}, prev)
+	c.Assert(err, check.IsNil)
+	prevForwarder.mu.Unlock()
+	change := replaceSender(nil, prev, next)
+	change.apply()
+	defer next.stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		var processed []LogMessage
+		for _, f := range forwarders {
+			f.mu.Lock()
+			processed = append(processed, f.processed...)
+			f.mu.Unlock()
+		}
+		prevForwarder.mu.Lock()
+		processed = append(processed, prevForwarder.processed...)
+		prevForwarder.mu.Unlock()
+		if len(processed) == 3 {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatalf("timeout waiting for messages, processed: %v", processed)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	var found bool
+	for _, st := range backendShardStats("fake") {
+		c.Assert(st.Forwarder, check.Not(check.Equals), "fake takeover")
+		if st.Forwarder == "fake takeover next" {
+			found = true
+		}
+	}
+	c.Assert(found, check.Equals, true)
+}
+
+func (s *S) TestShardedSenderAbandon(c *check.C) {
+	prevForwarder := &namedFakeForwarder{name: "fake abandon"}
+	prev, err := newShardedSender("fake", 1, 10, func() forwarderBackend {
+		return prevForwarder
+	}, nil)
+	c.Assert(err, check.IsNil)
+	defer prev.stop()
+	next, err := newShardedSender("fake", 1, 10, func() forwarderBackend {
+		return &namedFakeForwarder{name: "fake abandon next"}
+	}, prev)
+	c.Assert(err, check.IsNil)
+	c.Assert(next.chans[0], check.Equals, prev.chans[0])
+	replaceSender(nil, prev, next).cancel()
+	for _, w := range next.workers {
+		<-w.done
+	}
+	c.Assert(prev.send("myapp", "a"), check.Equals, true)
+	timeout := time.After(5 * time.Second)
+	for {
+		prevForwarder.mu.Lock()
+		processed := len(prevForwarder.processed)
+		prevForwarder.mu.Unlock()
+		if processed == 1 {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for the previous forwarder")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -9,12 +9,14 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/tsuru/bs/bslog"
 	"github.com/tsuru/bs/config"
 	"github.com/tsuru/bs/container"
+	"github.com/tsuru/bs/telemetry"
 )
 
 const (
@@ -26,10 +28,29 @@ type syslogBackend struct {
 	syslogLocation   *time.Location
 	syslogExtraStart []byte
 	syslogExtraEnd   []byte
-	msgChans         []chan<- LogMessage
-	quitChans        []chan<- bool
+	mtu              int
+	mu               sync.RWMutex
+	addrs            []string
+	senders          []*shardedSender
 	bufferPool       sync.Pool
 	nextNotify       *time.Timer
+	restartSettings  envSnapshot
+}
+
+// syslogRestartSettings are the syslog settings only applied when bs is
+// restarted, or to forward addresses added after a reload.
+var syslogRestartSettings = []string{
+	"LOG_SYSLOG_MESSAGE_EXTRA_START",
+	"LOG_SYSLOG_MESSAGE_EXTRA_END",
+	"LOG_SYSLOG_TIMEZONE",
+	"SYSLOG_TIMEZONE",
+	"LOG_SYSLOG_MTU_NETWORK_INTERFACE",
+	"LOG_SYSLOG_BUFFER_SIZE",
+	"LOG_BUFFER_SIZE",
+	"LOG_SYSLOG_CONN_MAX_AGE",
+	"LOG_SYSLOG_DROP_ON_OPEN_CIRCUIT",
+	"LOG_SYSLOG_WORKERS",
+	"LOG_DRAIN_TIMEOUT",
 }
 
 type syslogForwarder struct {
@@ -39,9 +60,12 @@ type syslogForwarder struct {
 	messageLimit  int
 	connCreatedAt time.Time
 	connMaxAge    time.Duration
+	dropOnOpen    bool
+	bytesSent     *telemetry.Counter
 }
 
 func (b *syslogBackend) initialize() error {
+	b.restartSettings = takeEnvSnapshot(syslogRestartSettings...)
 	extra := config.StringEnvOrDefault("", "LOG_SYSLOG_MESSAGE_EXTRA_START")
 	if extra != "" {
 		b.syslogExtraStart = []byte(os.ExpandEnv(extra) + " ")
@@ -50,11 +74,6 @@ func (b *syslogBackend) initialize() error {
 	if extra != "" {
 		b.syslogExtraEnd = []byte(" " + os.ExpandEnv(extra))
 	}
-	bufferSize := config.IntEnvOrDefault(config.DefaultBufferSize, "LOG_SYSLOG_BUFFER_SIZE", "LOG_BUFFER_SIZE")
-	forwardAddresses := config.StringsEnvOrDefault(nil, "LOG_SYSLOG_FORWARD_ADDRESSES", "SYSLOG_FORWARD_ADDRESSES")
-	if len(forwardAddresses) == 0 {
-		return nil
-	}
 	syslogTimezone := config.StringEnvOrDefault("", "LOG_SYSLOG_TIMEZONE", "SYSLOG_TIMEZONE")
 	b.syslogLocation = time.Local
 	if syslogTimezone != "" {
@@ -65,14 +84,14 @@ func (b *syslogBackend) initialize() error {
 			bslog.Warnf("unable to parse syslog timezone format: %s", err)
 		}
 	}
-	mtu := udpMessageDefaultMTU
+	b.mtu = udpMessageDefaultMTU
 	mtuInterface := config.StringEnvOrDefault("eth0", "LOG_SYSLOG_MTU_NETWORK_INTERFACE")
 	if mtuInterface != "" {
 		iface, err := net.InterfaceByName(mtuInterface)
 		if err == nil && iface.MTU > 0 {
-			mtu = iface.MTU
+			b.mtu = iface.MTU
 		} else {
-			bslog.Warnf("unable to read mtu from interface, using default %d: %s", mtu, err)
+			bslog.Warnf("unable to read mtu from interface, using default %d: %s", b.mtu, err)
 		}
 	}
 	b.bufferPool = sync.Pool{
@@ -81,25 +100,92 @@ func (b *syslogBackend) initialize() error {
 		},
 	}
 	b.nextNotify = time.NewTimer(0)
-	connMaxAge := config.SecondsEnvOrDefault(-1, "LOG_SYSLOG_CONN_MAX_AGE")
+	change, err := b.reload()
+	if err != nil {
+		return err
+	}
+	change.apply()
+	return nil
+}
+
+// reload starts forwarders for new addresses in
+// LOG_SYSLOG_FORWARD_ADDRESSES, which replace the current ones when the
+// change is committed, stopping the forwarders of removed addresses and
+// keeping the buffered messages of the remaining ones. Changes to other
+// syslog settings are reported as requiring a restart.
+func (b *syslogBackend) reload() (*backendChange, error) {
+	restartSettings := takeEnvSnapshot(syslogRestartSettings...)
+	if changed := b.restartSettings.changedSettings(); len(changed) > 0 {
+		bslog.Warnf("[log forwarder] syslog settings changed, restart bs to apply them: %s", strings.Join(changed, ", "))
+	}
+	forwardAddresses := config.StringsEnvOrDefault(nil, "LOG_SYSLOG_FORWARD_ADDRESSES", "SYSLOG_FORWARD_ADDRESSES")
+	b.mu.RLock()
+	current := make(map[string]*shardedSender, len(b.addrs))
+	for i, addr := range b.addrs {
+		current[addr] = b.senders[i]
+	}
+	b.mu.RUnlock()
+	var addrs []string
+	var senders, started []*shardedSender
 	for _, addr := range forwardAddresses {
-		forwardUrl, err := url.Parse(addr)
-		if err != nil {
-			return fmt.Errorf("unable to parse %q: %s", addr, err)
+		sender := current[addr]
+		if sender == nil {
+			var err error
+			sender, err = b.newSender(addr)
+			if err != nil {
+				stopSenders(started)
+				return nil, err
+			}
+			started = append(started, sender)
+		}
+		delete(current, addr)
+		addrs = append(addrs, addr)
+		senders = append(senders, sender)
+	}
+	commit := func() {
+		b.mu.Lock()
+		b.addrs = addrs
+		b.senders = senders
+		b.restartSettings = restartSettings
+		b.mu.Unlock()
+		for addr, sender := range current {
+			bslog.Warnf("[log forwarder] removing syslog forward address %s", addr)
+			sender.stop()
 		}
-		forwardChan, quitChan, err := processMessages(&syslogForwarder{
+	}
+	return &backendChange{
+		backend: b,
+		commit:  commit,
+		discard: func() { stopSenders(started) },
+	}, nil
+}
+
+func stopSenders(senders []*shardedSender) {
+	for _, s := range senders {
+		s.stop()
+	}
+}
+
+func (b *syslogBackend) newSender(addr string) (*shardedSender, error) {
+	forwardUrl, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %q: %s", addr, err)
+	}
+	bufferSize := config.IntEnvOrDefault(config.DefaultBufferSize, "LOG_SYSLOG_BUFFER_SIZE", "LOG_BUFFER_SIZE")
+	connMaxAge := config.SecondsEnvOrDefault(-1, "LOG_SYSLOG_CONN_MAX_AGE")
+	dropOnOpen := config.BoolEnvOrDefault(false, "LOG_SYSLOG_DROP_ON_OPEN_CIRCUIT")
+	workers := config.IntEnvOrDefault(1, "LOG_SYSLOG_WORKERS")
+	bytesSent := newBackendTelemetry("syslog").bytesSent
+	return newShardedSender("syslog", workers, bufferSize, func() forwarderBackend {
+		return &syslogForwarder{
 			url:        forwardUrl,
 			bufferPool: &b.bufferPool,
-			mtu:        mtu,
+			mtu:        b.mtu,
 			connMaxAge: connMaxAge,
-		}, bufferSize)
-		if err != nil {
-			return err
+			dropOnOpen: dropOnOpen,
+			bytesSent:  bytesSent,
 		}
-		b.msgChans = append(b.msgChans, forwardChan)
-		b.quitChans = append(b.quitChans, quitChan)
-	}
-	return nil
+	}, nil)
 }
 
 type bufferWithIdx struct {
@@ -109,7 +195,9 @@ type bufferWithIdx struct {
 }
 
 func (b *syslogBackend) sendMessage(parts *rawLogParts, c *container.Container) {
-	lenSyslogs := len(b.msgChans)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	lenSyslogs := len(b.senders)
 	if lenSyslogs == 0 {
 		return
 	}
@@ -131,7 +219,7 @@ func (b *syslogBackend) sendMessage(parts *rawLogParts, c *container.Container)
 	contentIdx := len(buffer)
 	buffer = append(buffer, b.syslogExtraEnd...)
 	buffer = append(buffer, '\n')
-	for i, ch := range b.msgChans {
+	for i, sender := range b.senders {
 		var chBuffer []byte
 		if i == lenSyslogs-1 {
 			chBuffer = buffer
@@ -139,13 +227,12 @@ func (b *syslogBackend) sendMessage(parts *rawLogParts, c *container.Container)
 			chBuffer = b.bufferPool.Get().([]byte)[:0]
 			chBuffer = append(chBuffer, buffer...)
 		}
-		select {
-		case ch <- bufferWithIdx{
+		sent := sender.send(appKey(c), bufferWithIdx{
 			buffer:     chBuffer,
 			headerIdx:  headerIdx,
 			contentIdx: contentIdx,
-		}:
-		default:
+		})
+		if !sent {
 			select {
 			case <-b.nextNotify.C:
 				bslog.Errorf("Dropping log messages to syslog due to full channel buffer.")
@@ -157,11 +244,21 @@ func (b *syslogBackend) sendMessage(parts *rawLogParts, c *container.Container)
 }
 
 func (b *syslogBackend) stop() {
-	for _, ch := range b.quitChans {
-		close(ch)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sender := range b.senders {
+		sender.stop()
 	}
 }
 
+func (f *syslogForwarder) String() string {
+	return "syslog " + f.url.String()
+}
+
+func (f *syslogForwarder) dropOnOpenCircuit() bool {
+	return f.dropOnOpen
+}
+
 func (f *syslogForwarder) connect() (net.Conn, error) {
 	conn, err := net.DialTimeout(f.url.Scheme, f.url.Host, forwardConnDialTimeout)
 	if err != nil {
@@ -239,6 +336,7 @@ func (f *syslogForwarder) writePart(conn net.Conn, buf []byte) error {
 	}
 	lenMsg := len(buf)
 	n, err := conn.Write(buf)
+	f.bytesSent.Add(uint64(n))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,106 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/tsuru/bs/telemetry"
+)
+
+var (
+	receivedMessages    = telemetry.NewCounter("bs_log_messages_received")
+	parseErrors         = telemetry.NewCounter("bs_log_parse_errors")
+	invalidMessages     = telemetry.NewCounter("bs_log_messages_invalid")
+	unknownContainer    = telemetry.NewCounter("bs_log_messages_unknown_container")
+	deduplicatedMsgs    = telemetry.NewCounter("bs_log_messages_deduplicated")
+	rateLimitedMessages = telemetry.NewCounter("bs_log_messages_rate_limited")
+	ruleDroppedMessages = telemetry.NewCounter("bs_log_messages_dropped_by_rule")
+	redactions          = telemetry.NewCounter("bs_log_redactions")
+)
+
+// appRedactions returns the counter of redactions in the logs of an app.
+func appRedactions(app string) *telemetry.Counter {
+	return telemetry.NewCounter("bs_log_redactions_" + app)
+}
+
+func init() {
+	for name := range logBackends {
+		backend := name
+		telemetry.RegisterGauge("bs_log_"+backend+"_buffered", func() float64 {
+			var buffered int
+			for _, st := range backendShardStats(backend) {
+				buffered += st.Buffered
+			}
+			return float64(buffered)
+		})
+	}
+}
+
+// registerShardGauge registers the gauge with the number of messages
+// buffered in the given shard of every forwarder of a backend.
+func registerShardGauge(backend string, shard int) {
+	telemetry.RegisterGauge(fmt.Sprintf("bs_log_%s_shard%d_buffered", backend, shard), func() float64 {
+		var buffered int
+		for _, st := range backendShardStats(backend) {
+			if st.Shard == shard {
+				buffered += st.Buffered
+			}
+		}
+		return float64(buffered)
+	})
+}
+
+// backendTelemetry holds the counters of a log backend, its zero value
+// discards every update.
+type backendTelemetry struct {
+	dropped    *telemetry.Counter
+	sent       *telemetry.Counter
+	bytesSent  *telemetry.Counter
+	sendErrors *telemetry.Counter
+	reconnects *telemetry.Counter
+	abandoned  *telemetry.Counter
+}
+
+func newBackendTelemetry(backend string) *backendTelemetry {
+	prefix := "bs_log_" + backend + "_"
+	return &backendTelemetry{
+		dropped:    telemetry.NewCounter(prefix + "dropped"),
+		sent:       telemetry.NewCounter(prefix + "sent"),
+		bytesSent:  telemetry.NewCounter(prefix + "bytes_sent"),
+		sendErrors: telemetry.NewCounter(prefix + "send_errors"),
+		reconnects: telemetry.NewCounter(prefix + "reconnects"),
+		abandoned:  telemetry.NewCounter(prefix + "abandoned"),
+	}
+}
+
+// forwarderTelemetry holds the counters updated by a single forwarder, the
+// counters of its backend and the dropped messages count of its shard.
+type forwarderTelemetry struct {
+	*backendTelemetry
+	shardDropped *uint64
+}
+
+// drop accounts n messages dropped by the forwarder.
+func (t *forwarderTelemetry) drop(n int) {
+	t.dropped.Add(uint64(n))
+	if t.shardDropped != nil {
+		atomic.AddUint64(t.shardDropped, uint64(n))
+	}
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w       io.Writer
+	counter *telemetry.Counter
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.counter.Add(uint64(n))
+	return n, err
+}
@@ -0,0 +1,110 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/tsuru/tsuru/app"
+)
+
+// seqApplog is an app.Applog tagged with the sequence number the tsuru API
+// acknowledges once the entry is stored.
+type seqApplog struct {
+	*app.Applog
+	Seq uint64
+}
+
+// wsAck is the message sent by the tsuru API acknowledging every entry up
+// to (and including) Ack.
+type wsAck struct {
+	Ack uint64
+}
+
+// inFlightWindow holds entries sent to the tsuru API and not yet
+// acknowledged, so they can be resent after a reconnection.
+type inFlightWindow struct {
+	mu      sync.Mutex
+	size    int
+	nextSeq uint64
+	entries []*seqApplog
+	space   chan struct{}
+}
+
+func newInFlightWindow(size int) *inFlightWindow {
+	if size <= 0 {
+		size = 1
+	}
+	return &inFlightWindow{
+		size:  size,
+		space: make(chan struct{}, 1),
+	}
+}
+
+// add assigns the next sequence number to entry and adds it to the window,
+// ok is false if the window is full, unless force is set.
+func (w *inFlightWindow) add(entry *app.Applog, force bool) (seqEntry *seqApplog, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.entries) >= w.size && !force {
+		return nil, false
+	}
+	w.nextSeq++
+	seqEntry = &seqApplog{Applog: entry, Seq: w.nextSeq}
+	w.entries = append(w.entries, seqEntry)
+	return seqEntry, true
+}
+
+// ack removes every entry with sequence number up to seq from the window,
+// returning how many were removed.
+func (w *inFlightWindow) ack(seq uint64) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var n int
+	for n < len(w.entries) && w.entries[n].Seq <= seq {
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	w.entries = append(w.entries[:0], w.entries[n:]...)
+	select {
+	case w.space <- struct{}{}:
+	default:
+	}
+	return n
+}
+
+// pending returns the entries not yet acknowledged, in order.
+func (w *inFlightWindow) pending() []*seqApplog {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*seqApplog(nil), w.entries...)
+}
+
+func (w *inFlightWindow) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.entries)
+}
+
+// readAcks reads the acknowledgements found in a text frame sent by the
+// tsuru API.
+func (w *inFlightWindow) readAcks(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var msg wsAck
+		err := decoder.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		w.ack(msg.Ack)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"golang.org/x/net/websocket"
+	"gopkg.in/check.v1"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+func (s *S) TestInFlightWindow(c *check.C) {
+	w := newInFlightWindow(2)
+	e1, ok := w.add(&app.Applog{Message: "a"}, false)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e1.Seq, check.Equals, uint64(1))
+	e2, ok := w.add(&app.Applog{Message: "b"}, false)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e2.Seq, check.Equals, uint64(2))
+	_, ok = w.add(&app.Applog{Message: "c"}, false)
+	c.Assert(ok, check.Equals, false)
+	c.Assert(w.ack(1), check.Equals, 1)
+	select {
+	case <-w.space:
+	default:
+		c.Fatal("expected space notification")
+	}
+	e3, ok := w.add(&app.Applog{Message: "c"}, false)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e3.Seq, check.Equals, uint64(3))
+	_, ok = w.add(&app.Applog{Message: "d"}, true)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(w.pending(), check.DeepEquals, []*seqApplog{e2, e3, {Applog: &app.Applog{Message: "d"}, Seq: 4}})
+	err := w.readAcks(strings.NewReader(`{"Ack": 2}{"Ack": 3}`))
+	c.Assert(err, check.IsNil)
+	c.Assert(w.len(), check.Equals, 1)
+	c.Assert(w.ack(1), check.Equals, 0)
+	err = w.readAcks(strings.NewReader(`{"Ack": "x"}`))
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestLogForwarderWSForwarderAckResend(c *check.C) {
+	type received struct {
+		query string
+		seqs  []uint64
+	}
+	connCh := make(chan received, 2)
+	var conns int
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		conns++
+		first := conns == 1
+		r := received{query: ws.Request().URL.RawQuery}
+		decoder := json.NewDecoder(ws)
+		for {
+			var entry seqApplog
+			if err := decoder.Decode(&entry); err != nil {
+				break
+			}
+			r.seqs = append(r.seqs, entry.Seq)
+			if first && entry.Seq == 3 {
+				websocket.JSON.Send(ws, wsAck{Ack: 1})
+				break
+			}
+			if !first && entry.Seq == 4 {
+				websocket.JSON.Send(ws, wsAck{Ack: 4})
+				break
+			}
+		}
+		connCh <- r
+		if !first {
+			var discard []byte
+			websocket.Message.Receive(ws, &discard)
+		}
+	}))
+	defer srv.Close()
+	os.Setenv("TSURU_ENDPOINT", srv.URL)
+	os.Setenv("LOG_TSURU_ACK_MODE", "true")
+	os.Setenv("LOG_TSURU_PING_INTERVAL", "0.1")
+	os.Setenv("LOG_TSURU_PONG_INTERVAL", "0.5")
+	defer os.Unsetenv("LOG_TSURU_ACK_MODE")
+	lf := LogForwarder{
+		EnabledBackends: []string{"tsuru"},
+		BindAddress:     "udp://127.0.0.1:59317",
+		DockerEndpoint:  s.dockerServer.URL(),
+	}
+	err := lf.Start()
+	c.Assert(err, check.IsNil)
+	defer lf.stopWait()
+	send := func(i int) {
+		lf.Handle(format.LogParts{"parts": &rawLogParts{
+			ts:        time.Date(2015, 6, 5, 16, 13, 47, 0, time.UTC),
+			priority:  []byte("30"),
+			content:   []byte(fmt.Sprintf("msg %d", i)),
+			container: []byte(s.id),
+		}}, 0, nil)
+	}
+	for i := 1; i <= 3; i++ {
+		send(i)
+	}
+	var results []received
+	for i := 0; i < 2; i++ {
+		if i == 1 {
+			time.Sleep(200 * time.Millisecond)
+			send(4)
+		}
+		select {
+		case r := <-connCh:
+			results = append(results, r)
+		case <-time.After(10 * time.Second):
+			c.Fatal("timeout waiting for websocket connection")
+		}
+	}
+	c.Assert(results, check.DeepEquals, []received{
+		{query: "ack=true", seqs: []uint64{1, 2, 3}},
+		{query: "ack=true", seqs: []uint64{2, 3, 4}},
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"net/url"
 	"sync"
 	"sync/atomic"
@@ -20,6 +21,7 @@ import (
 	"github.com/tsuru/bs/bslog"
 	"github.com/tsuru/bs/config"
 	"github.com/tsuru/bs/container"
+	"github.com/tsuru/bs/telemetry"
 	"github.com/tsuru/tsuru/app"
 	"golang.org/x/net/websocket"
 )
@@ -29,11 +31,16 @@ var (
 	testTlsConfig *tls.Config
 
 	errConnMaxAgeExceeded = errors.New("max connection age exceeded")
+	errAckTimeout         = errors.New("timeout waiting for acknowledgements from tsuru")
+	errConnClosed         = errors.New("connection closed")
 )
 
+// tsuruSettings are the environment variables used by the tsuru backend.
+var tsuruSettings = []string{"TSURU_ENDPOINT", "TSURU_TOKEN", "LOG_TSURU_", "LOG_WS_", "LOG_BUFFER_SIZE", "LOG_DRAIN_TIMEOUT"}
+
 type tsuruBackend struct {
-	msgCh      chan<- LogMessage
-	quitCh     chan<- bool
+	envSnapshot
+	sender     *shardedSender
 	nextNotify *time.Timer
 }
 
@@ -49,13 +56,45 @@ type wsForwarder struct {
 	connCreatedAt time.Time
 	connMaxAge    time.Duration
 	expireConnCh  chan bool
+	connDone      chan struct{}
+	dropOnOpen    bool
+	ackWindow     *inFlightWindow
+	bytesSent     *telemetry.Counter
+	dropped       *telemetry.Counter
+
+	transport         string
+	httpURL           string
+	httpClient        *http.Client
+	httpBatchSize     int
+	httpBatchInterval time.Duration
+	httpFallbackAfter int
+	httpRetryInterval time.Duration
+	wsFailures        int
+	usingHTTP         bool
+	httpSince         time.Time
 }
 
 func (b *tsuruBackend) initialize() error {
-	config.LoadConfig()
-	if config.Config.TsuruEndpoint == "" {
+	return b.init(nil)
+}
+
+func (b *tsuruBackend) restart() (*backendChange, error) {
+	replacement := &tsuruBackend{}
+	if err := replacement.init(b.sender); err != nil {
+		return nil, err
+	}
+	return replaceSender(replacement, b.sender, replacement.sender), nil
+}
+
+// init starts the forwarders of the backend, replacing the ones of prev if
+// not nil.
+func (b *tsuruBackend) init(prev *shardedSender) error {
+	b.envSnapshot = takeEnvSnapshot(tsuruSettings...)
+	tsuruEndpoint := config.StringEnvOrDefault("", "TSURU_ENDPOINT")
+	if tsuruEndpoint == "" {
 		return fmt.Errorf("environment variable for TSURU_ENDPOINT must be set")
 	}
+	tsuruToken := config.StringEnvOrDefault("", "TSURU_TOKEN")
 	bufferSize := config.IntEnvOrDefault(config.DefaultBufferSize, "LOG_TSURU_BUFFER_SIZE", "LOG_BUFFER_SIZE")
 	wsPingInterval := config.SecondsEnvOrDefault(config.DefaultWsPingInterval, "LOG_TSURU_PING_INTERVAL", "LOG_WS_PING_INTERVAL")
 	wsPongInterval := config.SecondsEnvOrDefault(0, "LOG_TSURU_PONG_INTERVAL", "LOG_WS_PONG_INTERVAL")
@@ -65,30 +104,70 @@ func (b *tsuruBackend) initialize() error {
 		wsPongInterval = newPongInterval
 	}
 	wsConnMaxAge := config.SecondsEnvOrDefault(-1, "LOG_TSURU_CONN_MAX_AGE")
+	ackMode := config.BoolEnvOrDefault(false, "LOG_TSURU_ACK_MODE")
+	var ackWindowSize int
+	if ackMode {
+		ackWindowSize = config.IntEnvOrDefault(1000, "LOG_TSURU_ACK_WINDOW")
+	}
+	transport := config.StringEnvOrDefault(tsuruTransportWebsocket, "LOG_TSURU_TRANSPORT")
+	switch transport {
+	case tsuruTransportWebsocket, tsuruTransportHTTP, tsuruTransportAuto:
+	default:
+		return fmt.Errorf("invalid LOG_TSURU_TRANSPORT %q, expected websocket, http or auto", transport)
+	}
 	b.nextNotify = time.NewTimer(0)
-	tsuruUrl, err := url.Parse(config.Config.TsuruEndpoint)
+	tsuruUrl, err := url.Parse(tsuruEndpoint)
 	if err != nil {
 		return err
 	}
 	tsuruUrl.Path = "/logs"
+	httpURL := tsuruUrl.String()
+	if ackMode {
+		tsuruUrl.RawQuery = "ack=true"
+	}
 	if tsuruUrl.Scheme == "https" {
 		tsuruUrl.Scheme = "wss"
 	} else {
 		tsuruUrl.Scheme = "ws"
 	}
-	forwardChan, quitChan, err := processMessages(&wsForwarder{
-		url:          tsuruUrl.String(),
-		token:        config.Config.TsuruToken,
-		pingInterval: wsPingInterval,
-		pongInterval: wsPongInterval,
-		connMaxAge:   wsConnMaxAge,
-	}, bufferSize)
-	if err != nil {
-		return err
+	dropOnOpen := config.BoolEnvOrDefault(false, "LOG_TSURU_DROP_ON_OPEN_CIRCUIT")
+	httpClient := &http.Client{
+		Timeout: httpBatchTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: testTlsConfig,
+		},
 	}
-	b.msgCh = forwardChan
-	b.quitCh = quitChan
-	return nil
+	httpBatchSize := config.IntEnvOrDefault(100, "LOG_TSURU_HTTP_BATCH_SIZE")
+	httpBatchInterval := config.SecondsEnvOrDefault(1, "LOG_TSURU_HTTP_BATCH_INTERVAL")
+	httpFallbackAfter := config.IntEnvOrDefault(3, "LOG_TSURU_HTTP_FALLBACK_AFTER")
+	httpRetryInterval := config.SecondsEnvOrDefault(60, "LOG_TSURU_HTTP_RETRY_INTERVAL")
+	workers := config.IntEnvOrDefault(1, "LOG_TSURU_WORKERS")
+	counters := newBackendTelemetry("tsuru")
+	b.sender, err = newShardedSender("tsuru", workers, bufferSize, func() forwarderBackend {
+		f := &wsForwarder{
+			url:               tsuruUrl.String(),
+			token:             tsuruToken,
+			pingInterval:      wsPingInterval,
+			pongInterval:      wsPongInterval,
+			connMaxAge:        wsConnMaxAge,
+			dropOnOpen:        dropOnOpen,
+			transport:         transport,
+			httpURL:           httpURL,
+			httpClient:        httpClient,
+			httpBatchSize:     httpBatchSize,
+			httpBatchInterval: httpBatchInterval,
+			httpFallbackAfter: httpFallbackAfter,
+			httpRetryInterval: httpRetryInterval,
+			bytesSent:         counters.bytesSent,
+			dropped:           counters.dropped,
+		}
+		if ackMode {
+			f.ackWindow = newInFlightWindow(ackWindowSize)
+		}
+		return f
+	}, prev)
+	return err
 }
 
 func (b *tsuruBackend) sendMessage(parts *rawLogParts, c *container.Container) {
@@ -99,9 +178,7 @@ func (b *tsuruBackend) sendMessage(parts *rawLogParts, c *container.Container) {
 		Source:  c.ProcessName,
 		Unit:    c.ShortHostname,
 	}
-	select {
-	case b.msgCh <- msg:
-	default:
+	if !b.sender.send(appKey(c), msg) {
 		select {
 		case <-b.nextNotify.C:
 			bslog.Errorf("Dropping log messages to tsuru due to full channel buffer.")
@@ -112,14 +189,92 @@ func (b *tsuruBackend) sendMessage(parts *rawLogParts, c *container.Container) {
 }
 
 func (b *tsuruBackend) stop() {
-	close(b.quitCh)
+	b.sender.stop()
 }
 
 func (f *wsForwarder) initialize(quitCh <-chan bool) {
 	f.quitCh = quitCh
 }
 
+func (f *wsForwarder) String() string {
+	return "tsuru " + f.url
+}
+
+func (f *wsForwarder) dropOnOpenCircuit() bool {
+	return f.dropOnOpen
+}
+
+func (f *wsForwarder) unacked() int {
+	if f.ackWindow == nil {
+		return 0
+	}
+	return f.ackWindow.len()
+}
+
+// connect opens a websocket to the tsuru API or, depending on the
+// transport, an http batch connection. In auto mode, it falls back to http
+// after repeated websocket failures and retries the websocket every
+// httpRetryInterval.
 func (f *wsForwarder) connect() (net.Conn, error) {
+	switch f.transport {
+	case tsuruTransportHTTP:
+		return f.connectHTTP()
+	case tsuruTransportAuto:
+		if f.usingHTTP && time.Since(f.httpSince) < f.httpRetryInterval {
+			return f.connectHTTP()
+		}
+	}
+	conn, err := f.connectWS()
+	if f.transport != tsuruTransportAuto {
+		return conn, err
+	}
+	if err == nil {
+		f.wsFailures = 0
+		if f.usingHTTP {
+			bslog.Warnf("[log forwarder] websocket to tsuru recovered, switching back from http")
+			f.usingHTTP = false
+		}
+		return conn, nil
+	}
+	f.wsFailures++
+	if f.wsFailures < f.httpFallbackAfter {
+		return nil, err
+	}
+	if !f.usingHTTP {
+		bslog.Warnf("[log forwarder] unable to connect websocket to tsuru after %d attempts, falling back to http: %s", f.wsFailures, err)
+	}
+	f.usingHTTP = true
+	f.httpSince = time.Now()
+	return f.connectHTTP()
+}
+
+func (f *wsForwarder) connectHTTP() (net.Conn, error) {
+	if f.ackWindow == nil {
+		// Without acknowledgements, entries not posted when the connection
+		// is closed are lost.
+		onDropped := func(n int) {
+			f.dropped.Add(uint64(n))
+		}
+		return newHTTPBatchConn(f.httpURL, f.token, f.httpClient, f.httpBatchSize, f.httpBatchInterval, nil, onDropped), nil
+	}
+	onDelivered := func(seq uint64) {
+		f.ackWindow.ack(seq)
+	}
+	conn := newHTTPBatchConn(f.httpURL, f.token, f.httpClient, f.httpBatchSize, f.httpBatchInterval, onDelivered, nil)
+	for _, entry := range f.ackWindow.pending() {
+		data, err := json.Marshal(entry)
+		if err == nil {
+			err = conn.add(data, entry.Seq)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error resending message: %s", err)
+		}
+	}
+	return conn, nil
+}
+
+func (f *wsForwarder) connectWS() (net.Conn, error) {
 	config, err := websocket.NewConfig(f.url, "ws://localhost/")
 	if err != nil {
 		return nil, err
@@ -142,12 +297,12 @@ func (f *wsForwarder) connect() (net.Conn, error) {
 		if port == "" {
 			port = "80"
 		}
-		client, err = dialer.Dial("tcp", fmt.Sprintf("%s:%s", host, port))
+		client, err = dialer.Dial("tcp", net.JoinHostPort(host, port))
 	case "wss":
 		if port == "" {
 			port = "443"
 		}
-		client, err = tls.DialWithDialer(dialer, "tcp", fmt.Sprintf("%s:%s", host, port), config.TlsConfig)
+		client, err = tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), config.TlsConfig)
 	default:
 		err = websocket.ErrBadScheme
 	}
@@ -155,7 +310,8 @@ func (f *wsForwarder) connect() (net.Conn, error) {
 		return nil, err
 	}
 	f.connCreatedAt = time.Now()
-	f.expireConnCh = make(chan bool)
+	expireConnCh := make(chan bool)
+	f.expireConnCh = expireConnCh
 	ws, err := websocket.NewClient(config, client)
 	if err != nil {
 		client.Close()
@@ -169,15 +325,18 @@ func (f *wsForwarder) connect() (net.Conn, error) {
 	}
 	f.bufferConn = newBufferedConn(ws, time.Second)
 	lastPongTime := time.Now().UnixNano()
+	connDone := make(chan struct{})
+	f.connDone = connDone
 	stopWg.Add(2)
 	go func() {
 		defer stopWg.Done()
+		defer close(connDone)
 		defer client.Close()
 		for {
 			frame, err := ws.NewFrameReader()
 			if err != nil {
 				select {
-				case <-f.expireConnCh:
+				case <-expireConnCh:
 					return
 				default:
 				}
@@ -187,6 +346,11 @@ func (f *wsForwarder) connect() (net.Conn, error) {
 			if frame.PayloadType() == websocket.PongFrame {
 				atomic.StoreInt64(&lastPongTime, time.Now().UnixNano())
 			}
+			if frame.PayloadType() == websocket.TextFrame && f.ackWindow != nil {
+				if err = f.ackWindow.readAcks(frame); err != nil {
+					bslog.Errorf("[log forwarder] unable to parse acknowledgement from tsuru: %s", err)
+				}
+			}
 			_, _ = io.Copy(ioutil.Discard, frame)
 		}
 	}()
@@ -198,7 +362,7 @@ func (f *wsForwarder) connect() (net.Conn, error) {
 			case <-time.After(f.pingInterval):
 			case <-f.quitCh:
 				return
-			case <-f.expireConnCh:
+			case <-expireConnCh:
 				return
 			}
 			err := f.writeWithDeadline(ws, pingWriter, []byte{'z'})
@@ -215,10 +379,60 @@ func (f *wsForwarder) connect() (net.Conn, error) {
 			}
 		}
 	}()
-	f.jsonEncoder = json.NewEncoder(f.bufferConn)
+	f.jsonEncoder = json.NewEncoder(&countingWriter{w: f.bufferConn, counter: f.bytesSent})
+	if err = f.resendPending(); err != nil {
+		f.bufferConn.Close()
+		return nil, err
+	}
 	return f.bufferConn, nil
 }
 
+// resendPending sends again the entries not acknowledged by the tsuru API
+// before the previous connection was closed.
+func (f *wsForwarder) resendPending() error {
+	if f.ackWindow == nil {
+		return nil
+	}
+	pending := f.ackWindow.pending()
+	if len(pending) == 0 {
+		return nil
+	}
+	bslog.Warnf("[log forwarder] resending %d unacknowledged log messages to tsuru", len(pending))
+	f.connMutex.Lock()
+	defer f.connMutex.Unlock()
+	for _, entry := range pending {
+		err := f.bufferConn.SetWriteDeadline(time.Now().Add(forwardConnWriteTimeout))
+		if err != nil {
+			return fmt.Errorf("error setting deadline: %s", err)
+		}
+		err = f.jsonEncoder.Encode(entry)
+		if err != nil {
+			return fmt.Errorf("error resending message: %s", err)
+		}
+	}
+	return nil
+}
+
+// waitWindow adds the entry to the in-flight window, waiting for
+// acknowledgements if it's full. If none arrives within the pong interval
+// the entry is added anyway and an error is returned, forcing a reconnection
+// which resends every pending entry.
+func (f *wsForwarder) waitWindow(entry *app.Applog) (*seqApplog, error) {
+	timeout := time.After(f.pongInterval)
+	for {
+		seqEntry, ok := f.ackWindow.add(entry, false)
+		if ok {
+			return seqEntry, nil
+		}
+		select {
+		case <-f.ackWindow.space:
+		case <-timeout:
+			f.ackWindow.add(entry, true)
+			return nil, errAckTimeout
+		}
+	}
+}
+
 func (f *wsForwarder) writeWithDeadline(conn net.Conn, writer io.WriteCloser, data []byte) error {
 	f.connMutex.Lock()
 	defer f.connMutex.Unlock()
@@ -239,13 +453,30 @@ func (f *wsForwarder) writeWithDeadline(conn net.Conn, writer io.WriteCloser, da
 }
 
 func (f *wsForwarder) process(conn net.Conn, msg LogMessage) error {
+	var entry interface{} = msg
+	var seq uint64
+	if f.ackWindow != nil {
+		seqEntry, err := f.waitWindow(msg.(*app.Applog))
+		if err != nil {
+			return err
+		}
+		entry = seqEntry
+		seq = seqEntry.Seq
+	}
+	if httpConn, ok := conn.(*httpBatchConn); ok {
+		return f.processHTTP(httpConn, entry, seq)
+	}
+	select {
+	case <-f.connDone:
+		return errConnClosed
+	default:
+	}
 	f.connMutex.Lock()
 	defer f.connMutex.Unlock()
 	err := conn.SetWriteDeadline(time.Now().Add(forwardConnWriteTimeout))
 	if err != nil {
 		return fmt.Errorf("error setting deadline: %s", err)
 	}
-	entry := msg.(*app.Applog)
 	err = f.jsonEncoder.Encode(entry)
 	if err != nil {
 		return fmt.Errorf("error sending message: %s", err)
@@ -257,6 +488,22 @@ func (f *wsForwarder) process(conn net.Conn, msg LogMessage) error {
 	return nil
 }
 
+func (f *wsForwarder) processHTTP(conn *httpBatchConn, entry interface{}, seq uint64) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding message: %s", err)
+	}
+	err = conn.add(data, seq)
+	if err != nil {
+		return err
+	}
+	f.bytesSent.Add(uint64(len(data)))
+	if f.transport == tsuruTransportAuto && time.Since(f.httpSince) >= f.httpRetryInterval {
+		return errConnMaxAgeExceeded
+	}
+	return nil
+}
+
 func (f *wsForwarder) close(conn net.Conn) {
 	f.connMutex.Lock()
 	defer f.connMutex.Unlock()
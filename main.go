@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/google/gops/agent"
 	"github.com/tsuru/bs/bslog"
@@ -24,15 +25,26 @@ const (
 	version = "v1.15"
 )
 
-var printVersion bool
+var (
+	printVersion bool
+	checkConfig  bool
+	configFile   string
+)
 
 type StopWaiter interface {
 	Stop()
 	Wait()
 }
 
+type intervalStopWaiter interface {
+	StopWaiter
+	SetInterval(time.Duration)
+}
+
 func init() {
 	flag.BoolVar(&printVersion, "version", false, "Print version and exit")
+	flag.BoolVar(&checkConfig, "check-config", false, "Validate the configuration, print the effective settings and exit")
+	flag.StringVar(&configFile, "config", "", "Path to a YAML or JSON config file, overriding BS_CONFIG_FILE")
 }
 
 func startSignalHandler(callback func(os.Signal), signals ...os.Signal) {
@@ -45,6 +57,33 @@ func startSignalHandler(callback func(os.Signal), signals ...os.Signal) {
 	signal.Notify(sigChan, signals...)
 }
 
+func startReloadHandler(callback func()) {
+	sigChan := make(chan os.Signal, 1)
+	go func() {
+		for range sigChan {
+			callback()
+		}
+	}()
+	signal.Notify(sigChan, syscall.SIGHUP)
+}
+
+// reloadConfig reloads the configuration, applying it to the running
+// services where possible. config.Config is left untouched, as it's read by
+// the running services.
+func reloadConfig(lf *log.LogForwarder, runner intervalStopWaiter, reporter *status.Reporter) {
+	bslog.Infof("Reloading configuration")
+	settings := config.Load()
+	if err := lf.Reload(settings.LogBackends); err != nil {
+		bslog.Errorf("Unable to reload log forwarder: %s", err)
+	}
+	if runner != nil {
+		runner.SetInterval(settings.MetricsInterval)
+	}
+	if reporter != nil {
+		reporter.Reload(settings.StatusInterval)
+	}
+}
+
 func main() {
 	err := agent.Listen(&agent.Options{
 		NoShutdownCleanup: true,
@@ -58,6 +97,22 @@ func main() {
 		fmt.Printf("bs version %s\n", version)
 		return
 	}
+	if configFile != "" {
+		config.SetConfigFile(configFile)
+		config.LoadConfig()
+	}
+	err = config.Validate()
+	if checkConfig {
+		config.WriteEffective(os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid configuration:\n%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		bslog.Fatalf("Invalid configuration:\n%s\n", err)
+	}
 	lf := log.LogForwarder{
 		BindAddress:     config.Config.SyslogListenAddress,
 		DockerEndpoint:  config.Config.DockerEndpoint,
@@ -67,6 +122,15 @@ func main() {
 	if err != nil {
 		bslog.Fatalf("Unable to initialize log forwarder: %s\n", err)
 	}
+	var server *httpServer
+	if config.Config.HTTPListenAddress != "" {
+		server = newHTTPServer(config.Config.HTTPListenAddress, &lf)
+		err = server.Start()
+		if err != nil {
+			bslog.Warnf("Unable to initialize http server: %s\n", err)
+			server = nil
+		}
+	}
 	metricsRunner, err := initializeMetricsReporter()
 	if err != nil {
 		bslog.Warnf("Unable to initialize metrics runner: %s\n", err)
@@ -75,19 +139,37 @@ func main() {
 		TsuruEndpoint:  config.Config.TsuruEndpoint,
 		TsuruToken:     config.Config.TsuruToken,
 		DockerEndpoint: config.Config.DockerEndpoint,
+		InfoClient:     lf.InfoClient(),
 		Interval:       config.Config.StatusInterval,
 		Kubernetes:     isKubernetes(),
+		Events:         config.Config.StatusEvents,
+		EventsDebounce: config.Config.StatusEventsDebounce,
+		PayloadFormat:  config.Config.StatusPayloadFormat,
+		Zombie: status.ZombiePolicy{
+			Cycles:      config.Config.ZombieCycles,
+			MinAge:      config.Config.ZombieMinAge,
+			MaxRemovals: config.Config.ZombieMaxRemovals,
+			DryRun:      config.Config.ZombieDryRun,
+			Stop:        config.Config.ZombieAction == "stop",
+		},
 	})
 	if err != nil {
 		bslog.Warnf("Unable to initialize status reporter: %s\n", err)
 	}
 	waiters := []StopWaiter{&lf}
+	if server != nil {
+		server.setReady(reporter)
+		waiters = append(waiters, server)
+	}
 	if metricsRunner != nil {
 		waiters = append(waiters, metricsRunner)
 	}
 	if reporter != nil {
 		waiters = append(waiters, reporter)
 	}
+	startReloadHandler(func() {
+		reloadConfig(&lf, metricsRunner, reporter)
+	})
 	var signaled bool
 	startSignalHandler(func(signal os.Signal) {
 		signaled = true
@@ -103,7 +185,7 @@ func main() {
 	}
 }
 
-func initializeMetricsReporter() (StopWaiter, error) {
+func initializeMetricsReporter() (intervalStopWaiter, error) {
 	if !config.Config.MetricsEnable {
 		return nil, nil
 	}
@@ -115,6 +197,7 @@ func initializeMetricsReporter() (StopWaiter, error) {
 	metricsRunner.EnableBasicMetrics = config.Config.MetricsEnableBasic
 	metricsRunner.EnableConnMetrics = config.Config.MetricsEnableConn
 	metricsRunner.EnableHostMetrics = config.Config.MetricsEnableHost
+	metricsRunner.EnableTelemetry = config.Config.MetricsTelemetry
 	err := metricsRunner.Start()
 
 	if err != nil {
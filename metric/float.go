@@ -18,3 +18,9 @@ func (f float) MarshalJSON() ([]byte, error) {
 	}
 	return []byte(formatted), nil
 }
+
+// Float returns v as a value that is always encoded as a floating point
+// number by metric backends.
+func Float(v float64) interface{} {
+	return float(v)
+}
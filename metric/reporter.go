@@ -5,12 +5,19 @@
 package metric
 
 import (
+	"os"
 	"sync"
 
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/tsuru/bs/bslog"
 	"github.com/tsuru/bs/container"
 	"github.com/tsuru/bs/node"
+	"github.com/tsuru/bs/telemetry"
+)
+
+var (
+	sentMetrics = telemetry.NewCounter("bs_metric_sent")
+	sendErrors  = telemetry.NewCounter("bs_metric_send_errors")
 )
 
 type Reporter struct {
@@ -21,6 +28,7 @@ type Reporter struct {
 	enableBasicMetrics    bool
 	enableConnMetrics     bool
 	enableHostMetrics     bool
+	enableTelemetry       bool
 }
 
 func (r *Reporter) Do() {
@@ -39,6 +47,12 @@ func (r *Reporter) Do() {
 			bslog.Errorf("failed to get host metrics: %s", err)
 		}
 	}
+	if r.enableTelemetry {
+		err = r.sendTelemetry()
+		if err != nil {
+			bslog.Errorf("failed to send bs telemetry: %s", err)
+		}
+	}
 }
 
 func (r *Reporter) getMetrics(containers []docker.APIContainers, selectionEnvs []string) {
@@ -92,9 +106,11 @@ func (r *Reporter) sendMetrics(container *container.Container, metrics map[strin
 	for key, value := range metrics {
 		err := r.backend.Send(NewContainerInfo(container), key, value)
 		if err != nil {
+			sendErrors.Inc()
 			bslog.Errorf("failed to send metrics for container %#v: %s", container, err)
 			return err
 		}
+		sentMetrics.Inc()
 	}
 	return nil
 }
@@ -149,9 +165,35 @@ func (r *Reporter) sendHostMetrics(hostInfo HostInfo, metrics map[string]float)
 	for key, value := range metrics {
 		err := r.backend.SendHost(hostInfo, key, value)
 		if err != nil {
+			sendErrors.Inc()
 			bslog.Errorf("failed to send host metric %s: %s", key, err)
 			return err
 		}
+		sentMetrics.Inc()
 	}
 	return nil
 }
+
+// sendTelemetry sends the values in the bs telemetry registry as host
+// metrics.
+func (r *Reporter) sendTelemetry() error {
+	var hostname string
+	var err error
+	if r.hostClient != nil {
+		hostname, err = r.hostClient.GetHostname()
+	} else {
+		hostname, err = os.Hostname()
+	}
+	if err != nil {
+		return err
+	}
+	addrs, err := node.GetNodeAddrs()
+	if err != nil {
+		return err
+	}
+	metrics := make(map[string]float)
+	for key, value := range telemetry.Snapshot() {
+		metrics[key] = float(value)
+	}
+	return r.sendHostMetrics(HostInfo{Name: hostname, Addrs: addrs}, metrics)
+}
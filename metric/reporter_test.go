@@ -11,6 +11,7 @@ import (
 
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/tsuru/bs/container"
+	"github.com/tsuru/bs/telemetry"
 	"gopkg.in/check.v1"
 )
 
@@ -64,6 +65,23 @@ func (s *S) TestSendMetricsFailure(c *check.C) {
 	c.Assert(err, check.Equals, prepErr)
 }
 
+func (s *S) TestSendTelemetry(c *check.C) {
+	counter := telemetry.NewCounter("bs_test_reporter_counter")
+	counter.Add(3)
+	r := Reporter{backend: &fakeBackend}
+	err := r.sendTelemetry()
+	c.Assert(err, check.IsNil)
+	var found bool
+	for _, stat := range fakeBackend.stats {
+		c.Assert(stat.app, check.Equals, "sysapp")
+		if stat.key == "bs_test_reporter_counter" {
+			found = true
+			c.Assert(stat.value, check.Equals, float(counter.Value()))
+		}
+	}
+	c.Assert(found, check.Equals, true)
+}
+
 func (s *S) TestSendConnMetrics(c *check.C) {
 	cont := s.createContainer()
 	conns := []conn{
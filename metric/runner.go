@@ -19,15 +19,18 @@ type runner struct {
 	metricsBackend     string
 	abort              chan struct{}
 	exit               chan struct{}
+	reload             chan time.Duration
 	EnableBasicMetrics bool
 	EnableConnMetrics  bool
 	EnableHostMetrics  bool
+	EnableTelemetry    bool
 }
 
 func NewRunner(dockerEndpoint string, interval time.Duration, metricsBackend string) *runner {
 	return &runner{
 		abort:          make(chan struct{}),
 		exit:           make(chan struct{}),
+		reload:         make(chan time.Duration, 1),
 		dockerEndpoint: dockerEndpoint,
 		interval:       interval,
 		metricsBackend: metricsBackend,
@@ -70,15 +73,18 @@ func (r *runner) Start() (err error) {
 		enableBasicMetrics:    r.EnableBasicMetrics,
 		enableConnMetrics:     r.EnableConnMetrics,
 		enableHostMetrics:     r.EnableHostMetrics,
+		enableTelemetry:       r.EnableTelemetry,
 	}
 	go func() {
+		interval := r.interval
 		for {
 			reporter.Do()
 			select {
 			case <-r.abort:
 				close(r.exit)
 				return
-			case <-time.After(r.interval):
+			case <-time.After(interval):
+			case interval = <-r.reload:
 			}
 
 		}
@@ -86,6 +92,16 @@ func (r *runner) Start() (err error) {
 	return
 }
 
+// SetInterval changes the interval between metrics reports, metrics are
+// reported right away using the new interval.
+func (r *runner) SetInterval(interval time.Duration) {
+	select {
+	case <-r.reload:
+	default:
+	}
+	r.reload <- interval
+}
+
 // Stop stops the runner.
 func (r *runner) Stop() {
 	close(r.abort)
@@ -64,6 +64,43 @@ func (s *S) TestRunner(c *check.C) {
 	}
 }
 
+func (s *S) TestRunnerSetInterval(c *check.C) {
+	os.Unsetenv("CONTAINER_SELECTION_ENV")
+	bogusContainers := s.buildContainers()
+	dockerServer, conts := s.startDockerServer(bogusContainers, nil, c)
+	defer dockerServer.Stop()
+	s.prepareStats(dockerServer, conts)
+	r := NewRunner(dockerServer.URL(), time.Hour, "fake")
+	r.EnableBasicMetrics = true
+	err := r.Start()
+	c.Assert(err, check.IsNil)
+	defer r.Stop()
+	cpuStats := func() int {
+		fakeBackend.mu.Lock()
+		defer fakeBackend.mu.Unlock()
+		var n int
+		for _, stat := range fakeBackend.stats {
+			if stat.key == "cpu_max" {
+				n++
+			}
+		}
+		return n
+	}
+	waitStats := func(n int) {
+		timeout := time.After(5 * time.Second)
+		for cpuStats() < n {
+			select {
+			case <-timeout:
+				c.Fatalf("timeout waiting for %d cpu_max metrics, got %d", n, cpuStats())
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	waitStats(2)
+	r.SetInterval(2 * time.Hour)
+	waitStats(4)
+}
+
 func (s *S) TestRunnerSelectionEnv(c *check.C) {
 	os.Setenv("CONTAINER_SELECTION_ENV", "TSURU_APPNAME")
 	defer os.Unsetenv("CONTAINER_SELECTION_ENV")
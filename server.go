@@ -0,0 +1,152 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsuru/bs/bslog"
+	"github.com/tsuru/bs/log"
+	"github.com/tsuru/bs/status"
+	"github.com/tsuru/bs/telemetry"
+)
+
+const httpShutdownTimeout = 5 * time.Second
+
+// httpServer serves bs internal endpoints on a local address: telemetry
+// counters, health and readiness checks, pprof and JSON views of the state of
+// the log forwarder and the status reporter.
+type httpServer struct {
+	server    *http.Server
+	forwarder *log.LogForwarder
+	reporter  *status.Reporter
+	ready     int32
+	done      chan struct{}
+}
+
+func newHTTPServer(addr string, forwarder *log.LogForwarder) *httpServer {
+	s := &httpServer{
+		forwarder: forwarder,
+		done:      make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", telemetry.Handler())
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/log/backends", s.logBackends)
+	mux.HandleFunc("/log/kubernetes/monitors", s.kubernetesMonitors)
+	mux.HandleFunc("/log/container-cache", s.containerCache)
+	mux.HandleFunc("/status/checks", s.hostChecks)
+	mux.HandleFunc("/status/report", s.lastReport)
+	s.server = &http.Server{Addr: addr, Handler: mux}
+	return s
+}
+
+// setReady marks bs as ready, after every service is initialized.
+// The status reporter may be nil if status reporting is disabled.
+func (s *httpServer) setReady(reporter *status.Reporter) {
+	s.reporter = reporter
+	atomic.StoreInt32(&s.ready, 1)
+}
+
+func (s *httpServer) healthz(w http.ResponseWriter, r *http.Request) {
+	if err := s.forwarder.Healthy(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if atomic.LoadInt32(&s.ready) == 1 && s.reporter != nil {
+		if err := s.reporter.Healthy(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *httpServer) readyz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&s.ready) == 0 {
+		http.Error(w, "bs is starting", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *httpServer) logBackends(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.forwarder.Backends())
+}
+
+func (s *httpServer) kubernetesMonitors(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.forwarder.KubernetesMonitors())
+}
+
+func (s *httpServer) containerCache(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.forwarder.ContainerCache())
+}
+
+func (s *httpServer) hostChecks(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&s.ready) == 0 || s.reporter == nil {
+		http.Error(w, "status reporter is not running", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, s.reporter.LastHostChecks())
+}
+
+func (s *httpServer) lastReport(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&s.ready) == 0 || s.reporter == nil {
+		http.Error(w, "status reporter is not running", http.StatusNotFound)
+		return
+	}
+	last := s.reporter.LastReport()
+	if last == nil {
+		http.Error(w, "no status report sent yet", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, last)
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		bslog.Errorf("[http server] unable to encode response: %s", err)
+	}
+}
+
+func (s *httpServer) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer close(s.done)
+		err := s.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			bslog.Errorf("[http server] failed to serve: %s", err)
+		}
+	}()
+	return nil
+}
+
+func (s *httpServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	s.server.Shutdown(ctx)
+}
+
+func (s *httpServer) Wait() {
+	<-s.done
+}
@@ -0,0 +1,181 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dtesting "github.com/fsouza/go-dockerclient/testing"
+	"github.com/tsuru/bs/bslog"
+	"github.com/tsuru/bs/log"
+	"github.com/tsuru/bs/status"
+	"gopkg.in/check.v1"
+)
+
+type S struct{}
+
+var _ = check.Suite(S{})
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func (S) SetUpSuite(c *check.C) {
+	bslog.Logger = stdlog.New(ioutil.Discard, "", 0)
+}
+
+// startForwarder returns a running log forwarder without log backends.
+func startForwarder(c *check.C) *log.LogForwarder {
+	lf := &log.LogForwarder{EnabledBackends: []string{"none"}}
+	c.Assert(lf.Start(), check.IsNil)
+	return lf
+}
+
+// startReporter returns a stopped status reporter, after its first report is
+// sent to a tsuru API replying with statusCode.
+func startReporter(c *check.C, statusCode int) *status.Reporter {
+	dockerServer, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	tsuruServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		w.Write([]byte("[]"))
+	}))
+	reporter, err := status.NewReporter(&status.ReporterConfig{
+		Interval:       10 * time.Minute,
+		DockerEndpoint: dockerServer.URL(),
+		TsuruEndpoint:  tsuruServer.URL,
+		TsuruToken:     "some-token",
+	})
+	c.Assert(err, check.IsNil)
+	reporter.Stop()
+	tsuruServer.Close()
+	dockerServer.Stop()
+	return reporter
+}
+
+func get(c *check.C, s *httpServer, path string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", path, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func (S) TestHealthz(c *check.C) {
+	lf := &log.LogForwarder{}
+	s := newHTTPServer("127.0.0.1:0", lf)
+	recorder := get(c, s, "/healthz")
+	c.Assert(recorder.Code, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(recorder.Body.String(), check.Equals, "syslog server is not running\n")
+	lf = startForwarder(c)
+	defer lf.Stop()
+	s = newHTTPServer("127.0.0.1:0", lf)
+	recorder = get(c, s, "/healthz")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "ok\n")
+}
+
+func (S) TestHealthzReporter(c *check.C) {
+	lf := startForwarder(c)
+	defer lf.Stop()
+	s := newHTTPServer("127.0.0.1:0", lf)
+	s.setReady(startReporter(c, http.StatusOK))
+	recorder := get(c, s, "/healthz")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	s.setReady(startReporter(c, http.StatusInternalServerError))
+	recorder = get(c, s, "/healthz")
+	c.Assert(recorder.Code, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(recorder.Body.String(), check.Matches, "last status report failed: .*\n")
+}
+
+func (S) TestReadyz(c *check.C) {
+	lf := startForwarder(c)
+	defer lf.Stop()
+	s := newHTTPServer("127.0.0.1:0", lf)
+	recorder := get(c, s, "/readyz")
+	c.Assert(recorder.Code, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(recorder.Body.String(), check.Equals, "bs is starting\n")
+	s.setReady(nil)
+	recorder = get(c, s, "/readyz")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "ok\n")
+}
+
+func (S) TestMetrics(c *check.C) {
+	s := newHTTPServer("127.0.0.1:0", &log.LogForwarder{})
+	recorder := get(c, s, "/metrics")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(strings.Contains(recorder.Body.String(), "bs_log_messages_received"), check.Equals, true)
+}
+
+func (S) TestLogEndpoints(c *check.C) {
+	lf := startForwarder(c)
+	defer lf.Stop()
+	s := newHTTPServer("127.0.0.1:0", lf)
+	tests := []struct {
+		path     string
+		expected interface{}
+		result   interface{}
+	}{
+		{path: "/log/backends", expected: &[]log.BackendState{}, result: &[]log.BackendState{}},
+		{path: "/log/kubernetes/monitors", expected: &[]log.MonitorState{}, result: &[]log.MonitorState{}},
+	}
+	for _, tt := range tests {
+		recorder := get(c, s, tt.path)
+		c.Assert(recorder.Code, check.Equals, http.StatusOK)
+		c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+		c.Assert(json.Unmarshal(recorder.Body.Bytes(), tt.result), check.IsNil)
+		c.Assert(tt.result, check.DeepEquals, tt.expected)
+	}
+	recorder := get(c, s, "/log/container-cache")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var cache map[string]interface{}
+	c.Assert(json.Unmarshal(recorder.Body.Bytes(), &cache), check.IsNil)
+	c.Assert(cache, check.DeepEquals, map[string]interface{}{
+		"size":          0.0,
+		"capacity":      0.0,
+		"running":       0.0,
+		"hits":          0.0,
+		"misses":        0.0,
+		"watchesEvents": false,
+	})
+}
+
+func (S) TestStatusEndpointsWithoutReporter(c *check.C) {
+	s := newHTTPServer("127.0.0.1:0", &log.LogForwarder{})
+	for _, path := range []string{"/status/checks", "/status/report"} {
+		recorder := get(c, s, path)
+		c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+		c.Assert(recorder.Body.String(), check.Equals, "status reporter is not running\n")
+	}
+}
+
+func (S) TestStatusEndpoints(c *check.C) {
+	s := newHTTPServer("127.0.0.1:0", &log.LogForwarder{})
+	reporter := startReporter(c, http.StatusOK)
+	s.setReady(reporter)
+	recorder := get(c, s, "/status/report")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var report status.ReportState
+	c.Assert(json.Unmarshal(recorder.Body.Bytes(), &report), check.IsNil)
+	c.Assert(report.Err, check.Equals, "")
+	c.Assert(report.Checks, check.HasLen, len(reporter.LastHostChecks()))
+	recorder = get(c, s, "/status/checks")
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var checks []status.HostCheckResult
+	c.Assert(json.Unmarshal(recorder.Body.Bytes(), &checks), check.IsNil)
+	c.Assert(len(checks) > 0, check.Equals, true)
+	c.Assert(checks, check.HasLen, len(report.Checks))
+	for i, result := range checks {
+		c.Assert(result.Name, check.Equals, report.Checks[i].Name)
+	}
+}
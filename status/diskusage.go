@@ -0,0 +1,92 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/tsuru/bs/config"
+)
+
+var statfs = syscall.Statfs
+
+// diskUsageThresholds are the limits checked by the diskUsage check. Zero
+// values disable the respective limit.
+type diskUsageThresholds struct {
+	maxPercent       int
+	minFreeBytes     uint64
+	maxInodesPercent int
+	minFreeInodes    uint64
+}
+
+func diskUsageChecks() []hostCheck {
+	paths := config.StringsEnvOrDefault(nil, "HOSTCHECK_DISK_USAGE_PATHS")
+	if len(paths) == 0 {
+		return nil
+	}
+	thresholds := diskUsageThresholds{
+		maxPercent:       config.IntEnvOrDefault(90, "HOSTCHECK_DISK_USAGE_MAX_PERCENT"),
+		minFreeBytes:     uint64(config.IntEnvOrDefault(0, "HOSTCHECK_DISK_USAGE_MIN_FREE_MB")) << 20,
+		maxInodesPercent: config.IntEnvOrDefault(90, "HOSTCHECK_DISK_USAGE_MAX_INODES_PERCENT"),
+		minFreeInodes:    uint64(config.IntEnvOrDefault(0, "HOSTCHECK_DISK_USAGE_MIN_FREE_INODES")),
+	}
+	checks := make([]hostCheck, 0, len(paths))
+	for _, p := range paths {
+		checks = append(checks, &diskUsageCheck{path: p, thresholds: thresholds})
+	}
+	return checks
+}
+
+type diskUsageCheck struct {
+	path       string
+	thresholds diskUsageThresholds
+}
+
+func (c *diskUsageCheck) Kind() string {
+	return "diskUsage"
+}
+
+func (c *diskUsageCheck) Name() string {
+	return fmt.Sprintf("diskUsage-%s", c.path)
+}
+
+// Run checks the space and inodes available in the filesystem of the path.
+// Usage is computed as df does, considering only the blocks available to
+// unprivileged users.
+func (c *diskUsageCheck) Run() error {
+	var st syscall.Statfs_t
+	if err := statfs(c.path, &st); err != nil {
+		return err
+	}
+	blockSize := uint64(st.Bsize)
+	used := st.Blocks - st.Bfree
+	free := st.Bavail * blockSize
+	if percent := usagePercent(used, used+st.Bavail); c.thresholds.maxPercent > 0 && percent > float64(c.thresholds.maxPercent) {
+		return fmt.Errorf("disk usage of %q is %.1f%%, above the limit of %d%%", c.path, percent, c.thresholds.maxPercent)
+	}
+	if free < c.thresholds.minFreeBytes {
+		return fmt.Errorf("free space of %q is %d bytes, below the limit of %d bytes", c.path, free, c.thresholds.minFreeBytes)
+	}
+	// Some filesystems, like btrfs, have no fixed number of inodes and
+	// report zero.
+	if st.Files == 0 {
+		return nil
+	}
+	if percent := usagePercent(st.Files-st.Ffree, st.Files); c.thresholds.maxInodesPercent > 0 && percent > float64(c.thresholds.maxInodesPercent) {
+		return fmt.Errorf("inode usage of %q is %.1f%%, above the limit of %d%%", c.path, percent, c.thresholds.maxInodesPercent)
+	}
+	if st.Ffree < c.thresholds.minFreeInodes {
+		return fmt.Errorf("free inodes of %q is %d, below the limit of %d", c.path, st.Ffree, c.thresholds.minFreeInodes)
+	}
+	return nil
+}
+
+func usagePercent(used, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(used) * 100 / float64(total)
+}
@@ -0,0 +1,65 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"os"
+	"syscall"
+
+	"gopkg.in/check.v1"
+)
+
+func fakeStatfs(st syscall.Statfs_t) func() {
+	prev := statfs
+	statfs = func(path string, buf *syscall.Statfs_t) error {
+		*buf = st
+		return nil
+	}
+	return func() { statfs = prev }
+}
+
+func (s S) TestNewCheckCollectionDiskUsage(c *check.C) {
+	os.Setenv("HOSTCHECK_DISK_USAGE_PATHS", "/var/lib/docker, /var/log")
+	os.Setenv("HOSTCHECK_DISK_USAGE_MIN_FREE_MB", "2")
+	os.Setenv("HOSTCHECK_DISK_USAGE_MAX_INODES_PERCENT", "0")
+	defer os.Unsetenv("HOSTCHECK_DISK_USAGE_PATHS")
+	defer os.Unsetenv("HOSTCHECK_DISK_USAGE_MIN_FREE_MB")
+	defer os.Unsetenv("HOSTCHECK_DISK_USAGE_MAX_INODES_PERCENT")
+	checkColl := NewCheckCollection(nil)
+	thresholds := diskUsageThresholds{maxPercent: 90, minFreeBytes: 2 << 20}
+	c.Assert(checkColl.checks, check.DeepEquals, []hostCheck{
+		&writableCheck{path: "/"},
+		&forceErrorCheck{path: "/"},
+		&createContainerCheck{message: "ok"},
+		&diskUsageCheck{path: "/var/lib/docker", thresholds: thresholds},
+		&diskUsageCheck{path: "/var/log", thresholds: thresholds},
+	})
+}
+
+func (s S) TestDiskUsageCheckRun(c *check.C) {
+	defer fakeStatfs(syscall.Statfs_t{Bsize: 1024, Blocks: 1000, Bfree: 150, Bavail: 100, Files: 100, Ffree: 50})()
+	hc := &diskUsageCheck{path: "/var/lib/docker"}
+	c.Assert(hc.Kind(), check.Equals, "diskUsage")
+	c.Assert(hc.Name(), check.Equals, "diskUsage-/var/lib/docker")
+	for _, tt := range []struct {
+		thresholds diskUsageThresholds
+		err        string
+	}{
+		{thresholds: diskUsageThresholds{}},
+		{thresholds: diskUsageThresholds{maxPercent: 90, minFreeBytes: 100 << 10, maxInodesPercent: 50, minFreeInodes: 50}},
+		{thresholds: diskUsageThresholds{maxPercent: 85}, err: `disk usage of "/var/lib/docker" is 89.5%, above the limit of 85%`},
+		{thresholds: diskUsageThresholds{minFreeBytes: 1 << 20}, err: `free space of "/var/lib/docker" is 102400 bytes, below the limit of 1048576 bytes`},
+		{thresholds: diskUsageThresholds{maxInodesPercent: 40}, err: `inode usage of "/var/lib/docker" is 50.0%, above the limit of 40%`},
+		{thresholds: diskUsageThresholds{minFreeInodes: 51}, err: `free inodes of "/var/lib/docker" is 50, below the limit of 51`},
+	} {
+		hc.thresholds = tt.thresholds
+		err := hc.Run()
+		if tt.err == "" {
+			c.Check(err, check.IsNil)
+		} else {
+			c.Check(err, check.ErrorMatches, tt.err)
+		}
+	}
+}
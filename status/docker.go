@@ -0,0 +1,215 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/bs/config"
+)
+
+// dockerChecks returns the Docker latency, storage driver and image pull
+// checks enabled through the environment.
+func dockerChecks(client *docker.Client) []hostCheck {
+	var checks []hostCheck
+	if maxLatency := config.SecondsEnvOrDefault(0, "HOSTCHECK_DOCKER_MAX_LATENCY"); maxLatency > 0 {
+		checks = append(checks, &dockerLatencyCheck{client: client, maxLatency: maxLatency})
+	}
+	if config.BoolEnvOrDefault(false, "HOSTCHECK_DOCKER_STORAGE_ENABLE") {
+		checks = append(checks, &dockerStorageCheck{
+			client:         client,
+			drivers:        config.StringsEnvOrDefault(nil, "HOSTCHECK_DOCKER_STORAGE_DRIVERS"),
+			minFreePercent: config.IntEnvOrDefault(10, "HOSTCHECK_DOCKER_STORAGE_MIN_FREE_PERCENT"),
+		})
+	}
+	if image := config.StringEnvOrDefault("", "HOSTCHECK_PULL_IMAGE"); image != "" {
+		checks = append(checks, &imagePullCheck{
+			client:  client,
+			image:   image,
+			timeout: config.SecondsEnvOrDefault(60, "HOSTCHECK_PULL_TIMEOUT"),
+			auth: docker.AuthConfiguration{
+				Username: config.StringEnvOrDefault("", "HOSTCHECK_PULL_USERNAME"),
+				Password: config.StringEnvOrDefault("", "HOSTCHECK_PULL_PASSWORD"),
+			},
+		})
+	}
+	return checks
+}
+
+type dockerLatencyCheck struct {
+	client     *docker.Client
+	maxLatency time.Duration
+}
+
+func (c *dockerLatencyCheck) Kind() string {
+	return "dockerLatency"
+}
+
+func (c *dockerLatencyCheck) Name() string {
+	return "dockerLatency"
+}
+
+// Run times the ping, info and list containers calls to the Docker API,
+// failing when any of them takes longer than the maximum latency.
+func (c *dockerLatencyCheck) Run() error {
+	calls := []struct {
+		name string
+		fn   func() error
+	}{
+		{name: "ping", fn: c.client.Ping},
+		{name: "info", fn: func() error {
+			_, err := c.client.Info()
+			return err
+		}},
+		{name: "list containers", fn: func() error {
+			_, err := c.client.ListContainers(docker.ListContainersOptions{})
+			return err
+		}},
+	}
+	var slow []string
+	for _, call := range calls {
+		start := time.Now()
+		if err := call.fn(); err != nil {
+			return fmt.Errorf("docker %s failed: %s", call.name, err)
+		}
+		if elapsed := time.Since(start); elapsed > c.maxLatency {
+			slow = append(slow, fmt.Sprintf("%s took %s", call.name, elapsed))
+		}
+	}
+	if len(slow) > 0 {
+		return fmt.Errorf("docker API slower than %s: %s", c.maxLatency, strings.Join(slow, ", "))
+	}
+	return nil
+}
+
+type dockerStorageCheck struct {
+	client         *docker.Client
+	drivers        []string
+	minFreePercent int
+}
+
+func (c *dockerStorageCheck) Kind() string {
+	return "dockerStorage"
+}
+
+func (c *dockerStorageCheck) Name() string {
+	return "dockerStorage"
+}
+
+// Run checks the storage driver reported by docker info, along with the
+// free data and metadata space of devicemapper and the d_type support of
+// overlay drivers.
+func (c *dockerStorageCheck) Run() error {
+	info, err := c.client.Info()
+	if err != nil {
+		return err
+	}
+	if info.Driver == "" {
+		return fmt.Errorf("docker reported no storage driver")
+	}
+	if len(c.drivers) > 0 && !containsString(c.drivers, info.Driver) {
+		return fmt.Errorf("unexpected storage driver %q, expected one of %s", info.Driver, strings.Join(c.drivers, ", "))
+	}
+	status := make(map[string]string, len(info.DriverStatus))
+	for _, kv := range info.DriverStatus {
+		status[kv[0]] = kv[1]
+	}
+	if status["Supports d_type"] == "false" {
+		return fmt.Errorf("storage driver %q backing filesystem does not support d_type", info.Driver)
+	}
+	for _, space := range []string{"Data", "Metadata"} {
+		available, okAvailable := parseHumanSize(status[space+" Space Available"])
+		total, okTotal := parseHumanSize(status[space+" Space Total"])
+		if !okAvailable || !okTotal || total == 0 {
+			continue
+		}
+		if free := available * 100 / total; free < float64(c.minFreePercent) {
+			return fmt.Errorf("storage driver %q has %.1f%% of %s space available, below the limit of %d%%", info.Driver, free, strings.ToLower(space), c.minFreePercent)
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var sizeUnits = map[string]float64{
+	"B":  1,
+	"KB": 1e3,
+	"MB": 1e6,
+	"GB": 1e9,
+	"TB": 1e12,
+	"PB": 1e15,
+}
+
+// parseHumanSize parses sizes formatted by Docker in decimal units, like
+// "107.4 GB".
+func parseHumanSize(size string) (float64, bool) {
+	fields := strings.Fields(size)
+	if len(fields) != 2 {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	unit, ok := sizeUnits[strings.ToUpper(fields[1])]
+	if !ok {
+		return 0, false
+	}
+	return value * unit, true
+}
+
+type imagePullCheck struct {
+	client  *docker.Client
+	image   string
+	timeout time.Duration
+	auth    docker.AuthConfiguration
+}
+
+func (c *imagePullCheck) Kind() string {
+	return "imagePull"
+}
+
+func (c *imagePullCheck) Name() string {
+	return fmt.Sprintf("imagePull-%s", c.image)
+}
+
+// Run pulls the image, checking the access to the registry. Pulling an image
+// already present only downloads its manifest.
+func (c *imagePullCheck) Run() error {
+	repository, tag := docker.ParseRepositoryTag(c.image)
+	if tag == "" {
+		tag = "latest"
+	}
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	err := c.client.PullImage(docker.PullImageOptions{
+		Repository:   repository,
+		Tag:          tag,
+		OutputStream: ioutil.Discard,
+		Context:      ctx,
+	}, c.auth)
+	if err != nil {
+		return fmt.Errorf("unable to pull image %q: %s", c.image, err)
+	}
+	return nil
+}
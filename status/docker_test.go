@@ -0,0 +1,162 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"gopkg.in/check.v1"
+)
+
+func (s S) TestNewCheckCollectionDocker(c *check.C) {
+	envs := map[string]string{
+		"HOSTCHECK_DOCKER_MAX_LATENCY":     "0.5",
+		"HOSTCHECK_DOCKER_STORAGE_ENABLE":  "true",
+		"HOSTCHECK_DOCKER_STORAGE_DRIVERS": "overlay2, devicemapper",
+		"HOSTCHECK_PULL_IMAGE":             "registry.example.com/tsuru/busybox:1.36",
+		"HOSTCHECK_PULL_USERNAME":          "user",
+		"HOSTCHECK_PULL_PASSWORD":          "secret",
+	}
+	for k, v := range envs {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	checkColl := NewCheckCollection(nil)
+	c.Assert(checkColl.checks, check.DeepEquals, []hostCheck{
+		&writableCheck{path: "/"},
+		&forceErrorCheck{path: "/"},
+		&createContainerCheck{message: "ok"},
+		&dockerLatencyCheck{maxLatency: 500 * time.Millisecond},
+		&dockerStorageCheck{drivers: []string{"overlay2", "devicemapper"}, minFreePercent: 10},
+		&imagePullCheck{
+			image:   "registry.example.com/tsuru/busybox:1.36",
+			timeout: time.Minute,
+			auth:    docker.AuthConfiguration{Username: "user", Password: "secret"},
+		},
+	})
+}
+
+func (s S) TestDockerLatencyCheckRun(c *check.C) {
+	var delay time.Duration
+	dockerServer, _ := s.startDockerServer(nil, func(*http.Request) {
+		time.Sleep(delay)
+	}, c)
+	defer dockerServer.Stop()
+	client, err := docker.NewClient(dockerServer.URL())
+	c.Assert(err, check.IsNil)
+	hc := &dockerLatencyCheck{client: client, maxLatency: 5 * time.Second}
+	c.Assert(hc.Kind(), check.Equals, "dockerLatency")
+	c.Assert(hc.Name(), check.Equals, "dockerLatency")
+	c.Assert(hc.Run(), check.IsNil)
+	delay = 50 * time.Millisecond
+	hc.maxLatency = 10 * time.Millisecond
+	c.Assert(hc.Run(), check.ErrorMatches, `docker API slower than 10ms: ping took .*, info took .*, list containers took .*`)
+	dockerServer.Stop()
+	c.Assert(hc.Run(), check.ErrorMatches, `docker ping failed: .*`)
+}
+
+func (s S) TestDockerStorageCheckRun(c *check.C) {
+	dockerServer, _ := s.startDockerServer(nil, nil, c)
+	defer dockerServer.Stop()
+	var info docker.DockerInfo
+	dockerServer.CustomHandler("/info", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}))
+	client, err := docker.NewClient(dockerServer.URL())
+	c.Assert(err, check.IsNil)
+	hc := &dockerStorageCheck{client: client, minFreePercent: 10}
+	c.Assert(hc.Kind(), check.Equals, "dockerStorage")
+	c.Assert(hc.Name(), check.Equals, "dockerStorage")
+	tests := []struct {
+		info    docker.DockerInfo
+		drivers []string
+		err     string
+	}{
+		{info: docker.DockerInfo{Driver: "overlay2", DriverStatus: [][2]string{{"Backing Filesystem", "extfs"}, {"Supports d_type", "true"}}}},
+		{info: docker.DockerInfo{Driver: "overlay2"}, drivers: []string{"overlay2"}},
+		{info: docker.DockerInfo{}, err: "docker reported no storage driver"},
+		{info: docker.DockerInfo{Driver: "vfs"}, drivers: []string{"overlay2", "devicemapper"}, err: `unexpected storage driver "vfs", expected one of overlay2, devicemapper`},
+		{
+			info: docker.DockerInfo{Driver: "overlay", DriverStatus: [][2]string{{"Supports d_type", "false"}}},
+			err:  `storage driver "overlay" backing filesystem does not support d_type`,
+		},
+		{info: docker.DockerInfo{Driver: "devicemapper", DriverStatus: [][2]string{
+			{"Data Space Available", "50 GB"},
+			{"Data Space Total", "107.4 GB"},
+			{"Metadata Space Available", "2.1 GB"},
+			{"Metadata Space Total", "2.147 GB"},
+		}}},
+		{
+			info: docker.DockerInfo{Driver: "devicemapper", DriverStatus: [][2]string{
+				{"Data Space Available", "5 GB"},
+				{"Data Space Total", "100 GB"},
+			}},
+			err: `storage driver "devicemapper" has 5.0% of data space available, below the limit of 10%`,
+		},
+		{
+			info: docker.DockerInfo{Driver: "devicemapper", DriverStatus: [][2]string{
+				{"Data Space Available", "50 GB"},
+				{"Data Space Total", "100 GB"},
+				{"Metadata Space Available", "100 MB"},
+				{"Metadata Space Total", "2 GB"},
+			}},
+			err: `storage driver "devicemapper" has 5.0% of metadata space available, below the limit of 10%`,
+		},
+	}
+	for i, tt := range tests {
+		info = tt.info
+		hc.drivers = tt.drivers
+		err := hc.Run()
+		if tt.err == "" {
+			c.Check(err, check.IsNil, check.Commentf("test %d", i))
+		} else {
+			c.Check(err, check.ErrorMatches, tt.err, check.Commentf("test %d", i))
+		}
+	}
+}
+
+func (s S) TestParseHumanSize(c *check.C) {
+	tests := []struct {
+		size     string
+		expected float64
+		ok       bool
+	}{
+		{size: "107.4 GB", expected: 107.4e9, ok: true},
+		{size: "2.1 kB", expected: 2100, ok: true},
+		{size: "512 B", expected: 512, ok: true},
+		{size: "1 TB", expected: 1e12, ok: true},
+		{size: ""},
+		{size: "10GB"},
+		{size: "ten GB"},
+		{size: "10 XB"},
+	}
+	for _, tt := range tests {
+		size, ok := parseHumanSize(tt.size)
+		c.Check(ok, check.Equals, tt.ok, check.Commentf("size %q", tt.size))
+		c.Check(size, check.Equals, tt.expected, check.Commentf("size %q", tt.size))
+	}
+}
+
+func (s S) TestImagePullCheckRun(c *check.C) {
+	dockerServer, _ := s.startDockerServer(nil, nil, c)
+	defer dockerServer.Stop()
+	client, err := docker.NewClient(dockerServer.URL())
+	c.Assert(err, check.IsNil)
+	hc := &imagePullCheck{client: client, image: "tsuru/busybox", timeout: 5 * time.Second}
+	c.Assert(hc.Kind(), check.Equals, "imagePull")
+	c.Assert(hc.Name(), check.Equals, "imagePull-tsuru/busybox")
+	c.Assert(hc.Run(), check.IsNil)
+	_, err = client.InspectImage("tsuru/busybox:latest")
+	c.Assert(err, check.IsNil)
+	dockerServer.CustomHandler("/images/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized: authentication required", http.StatusInternalServerError)
+	}))
+	c.Assert(hc.Run(), check.ErrorMatches, `(?s)unable to pull image "tsuru/busybox": .*unauthorized: authentication required.*`)
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/bs/bslog"
+	"github.com/tsuru/bs/telemetry"
+)
+
+const defaultEventsDebounce = time.Second
+
+var (
+	unitUpdates      = telemetry.NewCounter("bs_status_unit_updates")
+	unitUpdateErrors = telemetry.NewCounter("bs_status_unit_update_errors")
+)
+
+// watchEvents subscribes to Docker container events, sending the status of
+// units started, stopped, killed by OOM or changing health right away, in
+// addition to the periodic full reports. Destroyed containers trigger a full
+// report, reconciling the units known by tsuru.
+func (r *Reporter) watchEvents(abort <-chan struct{}) {
+	r.infoClient.OnEvent(r.handleEvent)
+	if err := r.infoClient.WatchEvents(); err != nil {
+		bslog.Warnf("[status reporter] unable to watch docker events: %s", err)
+		return
+	}
+	r.eventsWg.Add(1)
+	go func() {
+		defer r.eventsWg.Done()
+		r.reportEvents(abort)
+	}()
+}
+
+func (r *Reporter) handleEvent(ev *docker.APIEvents) {
+	id, action := ev.Actor.ID, ev.Action
+	if id == "" {
+		id = ev.ID
+	}
+	if action == "" {
+		action = ev.Status
+	}
+	if strings.HasPrefix(action, "health_status") {
+		action = "health_status"
+	}
+	switch action {
+	case "die", "oom", "start", "health_status":
+		r.pendingMu.Lock()
+		r.pending[id] = struct{}{}
+		r.pendingMu.Unlock()
+		notify(r.unitEvents)
+	case "destroy":
+		r.pendingMu.Lock()
+		delete(r.pending, id)
+		r.pendingMu.Unlock()
+		notify(r.reconcile)
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// reportEvents sends the status of the units with pending events once no
+// other event is received for the debounce interval.
+func (r *Reporter) reportEvents(abort <-chan struct{}) {
+	debounce := r.config.EventsDebounce
+	if debounce <= 0 {
+		debounce = defaultEventsDebounce
+	}
+	for {
+		select {
+		case <-abort:
+			return
+		case <-r.unitEvents:
+		}
+	wait:
+		for {
+			select {
+			case <-abort:
+				return
+			case <-r.unitEvents:
+			case <-time.After(debounce):
+				break wait
+			}
+		}
+		r.pendingMu.Lock()
+		containers := make([]docker.APIContainers, 0, len(r.pending))
+		for id := range r.pending {
+			containers = append(containers, docker.APIContainers{ID: id})
+		}
+		r.pending = make(map[string]struct{})
+		r.pendingMu.Unlock()
+		r.reportUnits(containers)
+	}
+}
+
+// reportUnits sends the status of the given containers, along with the host
+// checks of the last full report.
+func (r *Reporter) reportUnits(containers []docker.APIContainers) {
+	units := r.retrieveContainerStatuses(containers)
+	if len(units) == 0 {
+		return
+	}
+	unitUpdates.Inc()
+	hostData := &hostStatus{
+		Addrs:  r.addrs,
+		Units:  units,
+		Checks: r.LastHostChecks(),
+	}
+	resp, err := r.updateNode(hostData)
+	if err == errRouteNotFound {
+		resp, err = r.updateUnits(hostData.Units)
+	}
+	if err != nil {
+		unitUpdateErrors.Inc()
+		bslog.Errorf("[status reporter] failed to send unit status to the tsuru server at %q: %s", r.config.TsuruEndpoint, err)
+		return
+	}
+	_, err = r.handleTsuruResponse(resp, nil)
+	if err != nil {
+		unitUpdateErrors.Inc()
+		bslog.Errorf("[status reporter] failed to handle tsuru response: %s", err)
+	}
+}
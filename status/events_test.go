@@ -0,0 +1,132 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ajg/form"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/bs/bslog"
+	"github.com/tsuru/bs/container"
+	"gopkg.in/check.v1"
+)
+
+func (s S) TestReportStatusEvents(c *check.C) {
+	bslog.Logger = log.New(ioutil.Discard, "", 0)
+	bogusContainers := []bogusContainer{
+		{name: "x1", config: docker.Config{Image: "tsuru/python", Env: []string{"TSURU_APPNAME=someapp"}}, state: docker.State{Running: true}},
+		{name: "x2", config: docker.Config{Image: "tsuru/python", Env: []string{"TSURU_APPNAME=someapp"}}, state: docker.State{Running: false, StartedAt: time.Now().Add(-time.Hour)}},
+		{name: "x3", config: docker.Config{Image: "tsuru/python"}, state: docker.State{Running: true}},
+	}
+	dockerServer, containers := s.startDockerServer(bogusContainers, nil, c)
+	defer dockerServer.Stop()
+	events := make(chan docker.APIEvents)
+	dockerServer.CustomHandler("/events", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		encoder := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev := <-events:
+				encoder.Encode(ev)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	tsuruServer, requests := s.startTsuruServer(func(*http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString("[]"))}
+	})
+	defer tsuruServer.Close()
+	reporter, err := NewReporter(&ReporterConfig{
+		Interval:       10 * time.Minute,
+		DockerEndpoint: dockerServer.URL(),
+		TsuruEndpoint:  tsuruServer.URL,
+		TsuruToken:     "some-token",
+		Events:         true,
+		EventsDebounce: 100 * time.Millisecond,
+	})
+	c.Assert(err, check.IsNil)
+	defer reporter.Stop()
+	receive := func() hostStatus {
+		select {
+		case req := <-requests:
+			var input hostStatus
+			err := form.DecodeString(&input, string(req.body))
+			c.Assert(err, check.IsNil)
+			sort.Slice(input.Units, func(i, j int) bool {
+				return input.Units[i].Name < input.Units[j].Name
+			})
+			return input
+		case <-time.After(5 * time.Second):
+			c.Fatal("timeout waiting for status report")
+		}
+		return hostStatus{}
+	}
+	full := receive()
+	c.Assert(full.Units, check.HasLen, 2)
+	c.Assert(full.Checks, check.HasLen, 3)
+	for _, ev := range []docker.APIEvents{
+		{Type: "container", Action: "die", Actor: docker.APIActor{ID: containers[1].ID}},
+		{Type: "container", Action: "health_status: unhealthy", Actor: docker.APIActor{ID: containers[0].ID}},
+		{Type: "container", Action: "start", Actor: docker.APIActor{ID: containers[2].ID}},
+		{Type: "container", Action: "exec_start", Actor: docker.APIActor{ID: containers[0].ID}},
+	} {
+		events <- ev
+	}
+	update := receive()
+	c.Assert(update.Units, check.DeepEquals, []containerStatus{
+		{ID: containers[0].ID, Name: "x1", Status: "started"},
+		{ID: containers[1].ID, Name: "x2", Status: "stopped"},
+	})
+	c.Assert(update.Checks, check.HasLen, 3)
+	events <- docker.APIEvents{Type: "container", Action: "destroy", Actor: docker.APIActor{ID: "gone"}}
+	reconciled := receive()
+	c.Assert(reconciled.Units, check.HasLen, 2)
+	select {
+	case <-requests:
+		c.Fatal("unexpected status report")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func (s S) TestReporterSharedInfoClient(c *check.C) {
+	bslog.Logger = log.New(ioutil.Discard, "", 0)
+	dockerServer, _ := s.startDockerServer(nil, nil, c)
+	defer dockerServer.Stop()
+	dockerServer.CustomHandler("/events", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	tsuruServer, _ := s.startTsuruServer(func(*http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString("[]"))}
+	})
+	defer tsuruServer.Close()
+	infoClient, err := container.NewClient(dockerServer.URL())
+	c.Assert(err, check.IsNil)
+	c.Assert(infoClient.WatchEvents(), check.IsNil)
+	defer infoClient.StopWatchingEvents()
+	reporter, err := NewReporter(&ReporterConfig{
+		Interval:       10 * time.Minute,
+		DockerEndpoint: dockerServer.URL(),
+		TsuruEndpoint:  tsuruServer.URL,
+		TsuruToken:     "some-token",
+		Events:         true,
+		InfoClient:     infoClient,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(reporter.infoClient, check.Equals, infoClient)
+	reporter.Stop()
+	c.Assert(infoClient.CacheStats().WatchesEvents, check.Equals, true)
+}
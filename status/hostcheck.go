@@ -6,6 +6,7 @@ package status
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -30,12 +31,26 @@ type checkCollection struct {
 	checksFilterSet map[string]struct{}
 	timeout         time.Duration
 	errChannels     map[string]chan error
+	historySize     int
+	failurePercent  int
+	history         map[string][]CheckRun
 }
 
-type hostCheckResult struct {
+// HostCheckResult is the result of a host check sent in the status reports.
+type HostCheckResult struct {
 	Name       string
 	Err        string
 	Successful bool
+	// History holds the last runs of the check, oldest first. It's only
+	// sent in JSON payloads, when more than one run is kept.
+	History []CheckRun `form:"-" json:",omitempty"`
+}
+
+// CheckRun is the result of a single run of a host check.
+type CheckRun struct {
+	Time       time.Time
+	Successful bool
+	Err        string `json:",omitempty"`
 }
 
 var cgroupIDRegexp = regexp.MustCompile(`(?ms).*/([a-fA-F0-9]+?)$`)
@@ -47,6 +62,14 @@ func NewCheckCollection(client *docker.Client) *checkCollection {
 	failPathOverride := config.StringEnvOrDefault("/", "HOSTCHECK_FORCE_ERROR_PATH_OVERRIDE")
 	containerCheckMessage := config.StringEnvOrDefault("ok", "HOSTCHECK_CONTAINER_MESSAGE")
 	checksFilter := config.StringsEnvOrDefault(nil, "HOSTCHECK_KIND_FILTER")
+	historySize := config.IntEnvOrDefault(1, "HOSTCHECK_HISTORY_SIZE")
+	if historySize < 1 {
+		historySize = 1
+	}
+	failurePercent := config.IntEnvOrDefault(50, "HOSTCHECK_FAILURE_PERCENT")
+	if failurePercent < 0 {
+		failurePercent = 0
+	}
 	var checksFilterSet map[string]struct{}
 	if len(checksFilter) > 0 {
 		checksFilterSet = make(map[string]struct{})
@@ -63,53 +86,119 @@ func NewCheckCollection(client *docker.Client) *checkCollection {
 		checksFilterSet: checksFilterSet,
 		timeout:         hostCheckTimeout,
 		errChannels:     make(map[string]chan error),
+		historySize:     historySize,
+		failurePercent:  failurePercent,
+		history:         make(map[string][]CheckRun),
 	}
 	extraPaths := config.StringsEnvOrDefault(nil, "HOSTCHECK_EXTRA_PATHS")
 	for _, p := range extraPaths {
 		checkColl.checks = append(checkColl.checks, &writableCheck{path: p})
 	}
+	checkColl.checks = append(checkColl.checks, diskUsageChecks()...)
+	checkColl.checks = append(checkColl.checks, networkChecks()...)
+	checkColl.checks = append(checkColl.checks, scriptChecks()...)
+	checkColl.checks = append(checkColl.checks, dockerChecks(client)...)
 	return checkColl
 }
 
-func (c *checkCollection) Run() []hostCheckResult {
-	result := make([]hostCheckResult, 0, len(c.checks))
+// Run runs the checks concurrently, waiting up to the collection timeout for
+// all of them. Checks still running after the timeout are not started again
+// until they finish. A check is reported as failed when more than the
+// failure percentage of its last runs failed.
+func (c *checkCollection) Run() []HostCheckResult {
+	checks := make([]hostCheck, 0, len(c.checks))
 	for _, check := range c.checks {
 		if c.checksFilterSet != nil {
 			if _, inSet := c.checksFilterSet[check.Kind()]; !inSet {
 				continue
 			}
 		}
+		checks = append(checks, check)
 		name := check.Name()
-		checkResult := hostCheckResult{Name: name}
 		if c.errChannels[name] == nil {
 			c.errChannels[name] = make(chan error)
 			go func(hc hostCheck, errCh chan error) {
 				errCh <- hc.Run()
 			}(check, c.errChannels[name])
 		}
-		var timeoutCh <-chan time.Time
-		if c.timeout > 0 {
-			timeoutCh = time.After(c.timeout)
-		}
-		select {
-		case err := <-c.errChannels[name]:
-			checkResult.Successful = err == nil
-			if err != nil {
-				bslog.Errorf("[host check] failure running %q check: %s", name, err)
-				checkResult.Err = err.Error()
+	}
+	var timeoutCh <-chan time.Time
+	if c.timeout > 0 {
+		timer := time.NewTimer(c.timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	var timedOut bool
+	result := make([]HostCheckResult, 0, len(checks))
+	for _, check := range checks {
+		name := check.Name()
+		run := CheckRun{Time: time.Now()}
+		var err error
+		if timedOut {
+			select {
+			case err = <-c.errChannels[name]:
+				c.errChannels[name] = nil
+			default:
+				err = errCheckTimeout
 			}
-			c.errChannels[name] = nil
-		case <-timeoutCh:
-			checkResult.Successful = false
-			errMsg := fmt.Sprintf("[host check] timeout running %q check", name)
-			bslog.Errorf(errMsg)
-			checkResult.Err = errMsg
+		} else {
+			select {
+			case err = <-c.errChannels[name]:
+				c.errChannels[name] = nil
+			case <-timeoutCh:
+				timedOut = true
+				err = errCheckTimeout
+			}
+		}
+		run.Successful = err == nil
+		if err == errCheckTimeout {
+			run.Err = fmt.Sprintf("[host check] timeout running %q check", name)
+			bslog.Errorf(run.Err)
+		} else if err != nil {
+			bslog.Errorf("[host check] failure running %q check: %s", name, err)
+			run.Err = err.Error()
 		}
-		result = append(result, checkResult)
+		result = append(result, c.record(name, run))
 	}
 	return result
 }
 
+var errCheckTimeout = errors.New("timeout")
+
+// record adds the run to the history of the check, returning the check
+// result for the runs in the history.
+func (c *checkCollection) record(name string, run CheckRun) HostCheckResult {
+	history := append(c.history[name], run)
+	if len(history) > c.historySize {
+		history = history[len(history)-c.historySize:]
+	}
+	c.history[name] = history
+	var failures int
+	var lastErr string
+	for _, r := range history {
+		if !r.Successful {
+			failures++
+			lastErr = r.Err
+		}
+	}
+	checkResult := HostCheckResult{
+		Name:       name,
+		Successful: failures*100 <= c.failurePercent*len(history),
+	}
+	// An unsuccessful check reports the error of its last failed run, which
+	// may not be the last run.
+	if !checkResult.Successful {
+		checkResult.Err = lastErr
+	}
+	if c.historySize > 1 {
+		checkResult.History = append([]CheckRun(nil), history...)
+	}
+	if run.Successful != checkResult.Successful {
+		bslog.Debugf("[host check] %q check reported as successful=%t, %d of the last %d runs failed", name, checkResult.Successful, failures, len(history))
+	}
+	return checkResult
+}
+
 type writableCheck struct {
 	path string
 }
@@ -5,10 +5,14 @@
 package status
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/ajg/form"
 	docker "github.com/fsouza/go-dockerclient"
 	"gopkg.in/check.v1"
 )
@@ -137,7 +141,7 @@ func (s S) TestCheckCollectionRun(c *check.C) {
 	defer os.Unsetenv("HOSTCHECK_FORCE_ERROR_PATH_OVERRIDE")
 	checkColl := NewCheckCollection(client)
 	results := checkColl.Run()
-	c.Assert(results, check.DeepEquals, []hostCheckResult{
+	c.Assert(results, check.DeepEquals, []HostCheckResult{
 		{Name: "writablePath-" + tmpdir, Successful: true},
 		{Name: "forceError-" + tmpdir, Successful: true},
 		{Name: "createContainer", Successful: true},
@@ -167,7 +171,7 @@ func (s S) TestCheckCollectionRunFilterAll(c *check.C) {
 	defer os.Unsetenv("HOSTCHECK_FORCE_ERROR_PATH_OVERRIDE")
 	checkColl := NewCheckCollection(client)
 	results := checkColl.Run()
-	c.Assert(results, check.DeepEquals, []hostCheckResult{
+	c.Assert(results, check.DeepEquals, []HostCheckResult{
 		{Name: "writablePath-" + tmpdir, Successful: true},
 		{Name: "forceError-" + tmpdir, Successful: true},
 		{Name: "createContainer", Successful: true},
@@ -192,7 +196,7 @@ func (s S) TestCheckCollectionRunFilterSingle(c *check.C) {
 	defer os.Unsetenv("HOSTCHECK_KIND_FILTER")
 	checkColl := NewCheckCollection(client)
 	results := checkColl.Run()
-	c.Assert(results, check.DeepEquals, []hostCheckResult{
+	c.Assert(results, check.DeepEquals, []HostCheckResult{
 		{Name: "writablePath-" + tmpdir, Successful: true},
 	})
 }
@@ -219,11 +223,11 @@ func (s S) TestCheckCollectionRunTimeout(c *check.C) {
 	defer os.Unsetenv("HOSTCHECK_FORCE_ERROR_PATH_OVERRIDE")
 	checkColl := NewCheckCollection(client)
 	results := checkColl.Run()
-	resultsMap := map[string]hostCheckResult{}
+	resultsMap := map[string]HostCheckResult{}
 	for _, result := range results {
 		resultsMap[result.Name] = result
 	}
-	c.Assert(resultsMap, check.DeepEquals, map[string]hostCheckResult{
+	c.Assert(resultsMap, check.DeepEquals, map[string]HostCheckResult{
 		"writablePath-" + tmpdir: {Name: "writablePath-" + tmpdir, Err: "", Successful: true},
 		"forceError-" + tmpdir:   {Name: "forceError-" + tmpdir, Err: "", Successful: true},
 		"createContainer":        {Name: "createContainer", Err: "[host check] timeout running \"createContainer\" check", Successful: false},
@@ -329,3 +333,136 @@ func stopContainer(client *docker.Client, exceptID string, c *check.C) chan bool
 	}()
 	return done
 }
+
+type fakeCheck struct {
+	name  string
+	delay time.Duration
+	errs  []error
+	runs  int
+}
+
+func (c *fakeCheck) Kind() string {
+	return "fake"
+}
+
+func (c *fakeCheck) Name() string {
+	return c.name
+}
+
+func (c *fakeCheck) Run() error {
+	time.Sleep(c.delay)
+	var err error
+	if c.runs < len(c.errs) {
+		err = c.errs[c.runs]
+	}
+	c.runs++
+	return err
+}
+
+func newFakeCollection(historySize, failurePercent int, checks ...hostCheck) *checkCollection {
+	return &checkCollection{
+		checks:         checks,
+		errChannels:    make(map[string]chan error),
+		historySize:    historySize,
+		failurePercent: failurePercent,
+		history:        make(map[string][]CheckRun),
+	}
+}
+
+func (s S) TestNewCheckCollectionHistory(c *check.C) {
+	os.Setenv("HOSTCHECK_HISTORY_SIZE", "5")
+	os.Setenv("HOSTCHECK_FAILURE_PERCENT", "40")
+	defer os.Unsetenv("HOSTCHECK_HISTORY_SIZE")
+	defer os.Unsetenv("HOSTCHECK_FAILURE_PERCENT")
+	checkColl := NewCheckCollection(nil)
+	c.Assert(checkColl.historySize, check.Equals, 5)
+	c.Assert(checkColl.failurePercent, check.Equals, 40)
+	os.Setenv("HOSTCHECK_HISTORY_SIZE", "0")
+	checkColl = NewCheckCollection(nil)
+	c.Assert(checkColl.historySize, check.Equals, 1)
+}
+
+func (s S) TestCheckCollectionRunParallel(c *check.C) {
+	checkColl := newFakeCollection(1, 50,
+		&fakeCheck{name: "slow1", delay: 300 * time.Millisecond},
+		&fakeCheck{name: "slow2", delay: 300 * time.Millisecond},
+		&fakeCheck{name: "slow3", delay: 300 * time.Millisecond},
+	)
+	start := time.Now()
+	results := checkColl.Run()
+	c.Assert(time.Since(start) < 800*time.Millisecond, check.Equals, true)
+	c.Assert(results, check.DeepEquals, []HostCheckResult{
+		{Name: "slow1", Successful: true},
+		{Name: "slow2", Successful: true},
+		{Name: "slow3", Successful: true},
+	})
+}
+
+func (s S) TestCheckCollectionRunParallelTimeout(c *check.C) {
+	checkColl := newFakeCollection(1, 50,
+		&fakeCheck{name: "slow", delay: time.Second},
+		&fakeCheck{name: "fast"},
+		&fakeCheck{name: "slower", delay: 2 * time.Second},
+	)
+	checkColl.timeout = 200 * time.Millisecond
+	start := time.Now()
+	results := checkColl.Run()
+	c.Assert(time.Since(start) < 800*time.Millisecond, check.Equals, true)
+	c.Assert(results, check.DeepEquals, []HostCheckResult{
+		{Name: "slow", Err: `[host check] timeout running "slow" check`},
+		{Name: "fast", Successful: true},
+		{Name: "slower", Err: `[host check] timeout running "slower" check`},
+	})
+}
+
+func (s S) TestCheckCollectionRunFlapping(c *check.C) {
+	checkColl := newFakeCollection(3, 50,
+		&fakeCheck{name: "flapping", errs: []error{nil, fmt.Errorf("fail 1"), nil, fmt.Errorf("fail 2"), fmt.Errorf("fail 3"), nil, nil}},
+	)
+	expected := []struct {
+		successful bool
+		err        string
+		history    []bool
+	}{
+		{successful: true, history: []bool{true}},
+		{successful: true, history: []bool{true, false}},
+		{successful: true, history: []bool{true, false, true}},
+		{successful: false, err: "fail 2", history: []bool{false, true, false}},
+		{successful: false, err: "fail 3", history: []bool{true, false, false}},
+		{successful: false, err: "fail 3", history: []bool{false, false, true}},
+		{successful: true, history: []bool{false, true, true}},
+	}
+	for i, exp := range expected {
+		results := checkColl.Run()
+		c.Assert(results, check.HasLen, 1, check.Commentf("run %d", i))
+		c.Check(results[0].Successful, check.Equals, exp.successful, check.Commentf("run %d", i))
+		c.Check(results[0].Err, check.Equals, exp.err, check.Commentf("run %d", i))
+		history := make([]bool, len(results[0].History))
+		for j, run := range results[0].History {
+			history[j] = run.Successful
+		}
+		c.Check(history, check.DeepEquals, exp.history, check.Commentf("run %d", i))
+	}
+}
+
+func (s S) TestHostCheckResultHistoryPayload(c *check.C) {
+	result := HostCheckResult{
+		Name: "flapping",
+		Err:  "failed",
+		History: []CheckRun{
+			{Time: time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC), Successful: true},
+			{Time: time.Date(2026, 10, 19, 10, 1, 0, 0, time.UTC), Err: "failed"},
+		},
+	}
+	data, err := json.Marshal(result)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, `{"Name":"flapping","Err":"failed","Successful":false,"History":[`+
+		`{"Time":"2026-10-19T10:00:00Z","Successful":true},{"Time":"2026-10-19T10:01:00Z","Successful":false,"Err":"failed"}]}`)
+	body, err := form.EncodeToString(result)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Contains(body, "History"), check.Equals, false)
+	result.History = nil
+	data, err = json.Marshal(result)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, `{"Name":"flapping","Err":"failed","Successful":false}`)
+}
@@ -0,0 +1,139 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/bs/config"
+)
+
+var lookupHost = net.DefaultResolver.LookupHost
+
+// networkChecks returns the DNS, TCP and HTTP checks configured through the
+// environment. Each kind has its own timeout.
+func networkChecks() []hostCheck {
+	var checks []hostCheck
+	if names := config.StringsEnvOrDefault(nil, "HOSTCHECK_DNS_NAMES"); len(names) > 0 {
+		timeout := config.SecondsEnvOrDefault(5, "HOSTCHECK_DNS_TIMEOUT")
+		for _, name := range names {
+			checks = append(checks, &dnsCheck{host: name, timeout: timeout})
+		}
+	}
+	if targets := config.StringsEnvOrDefault(nil, "HOSTCHECK_TCP_TARGETS"); len(targets) > 0 {
+		timeout := config.SecondsEnvOrDefault(5, "HOSTCHECK_TCP_TIMEOUT")
+		for _, addr := range targets {
+			checks = append(checks, &tcpCheck{addr: addr, timeout: timeout})
+		}
+	}
+	if urls := config.StringsEnvOrDefault(nil, "HOSTCHECK_HTTP_TARGETS"); len(urls) > 0 {
+		timeout := config.SecondsEnvOrDefault(5, "HOSTCHECK_HTTP_TIMEOUT")
+		expectedStatus := config.IntEnvOrDefault(http.StatusOK, "HOSTCHECK_HTTP_EXPECTED_STATUS")
+		for _, target := range urls {
+			u, status := parseHTTPTarget(target, expectedStatus)
+			checks = append(checks, &httpCheck{url: u, expectedStatus: status, timeout: timeout})
+		}
+	}
+	return checks
+}
+
+// parseHTTPTarget splits an HTTP check target in the URL and the expected
+// status, set after a "|" as in "http://registry/v2/|401". "|" must be
+// escaped in URLs, so it never clashes with query strings such as "?id=404".
+// Targets without a valid status code suffix expect defaultStatus.
+func parseHTTPTarget(target string, defaultStatus int) (string, int) {
+	idx := strings.LastIndex(target, "|")
+	if idx == -1 {
+		return target, defaultStatus
+	}
+	status, err := strconv.Atoi(strings.TrimSpace(target[idx+1:]))
+	if err != nil || status < 100 || status > 599 {
+		return target, defaultStatus
+	}
+	return strings.TrimSpace(target[:idx]), status
+}
+
+type dnsCheck struct {
+	host    string
+	timeout time.Duration
+}
+
+func (c *dnsCheck) Kind() string {
+	return "dns"
+}
+
+func (c *dnsCheck) Name() string {
+	return fmt.Sprintf("dns-%s", c.host)
+}
+
+func (c *dnsCheck) Run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	addrs, err := lookupHost(ctx, c.host)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("no addresses found for %q", c.host)
+	}
+	return nil
+}
+
+type tcpCheck struct {
+	addr    string
+	timeout time.Duration
+}
+
+func (c *tcpCheck) Kind() string {
+	return "tcp"
+}
+
+func (c *tcpCheck) Name() string {
+	return fmt.Sprintf("tcp-%s", c.addr)
+}
+
+func (c *tcpCheck) Run() error {
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+type httpCheck struct {
+	url            string
+	expectedStatus int
+	timeout        time.Duration
+}
+
+func (c *httpCheck) Kind() string {
+	return "http"
+}
+
+func (c *httpCheck) Name() string {
+	return fmt.Sprintf("http-%s", c.url)
+}
+
+func (c *httpCheck) Run() error {
+	client := http.Client{Timeout: c.timeout}
+	resp, err := client.Get(c.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != c.expectedStatus {
+		return fmt.Errorf("unexpected status code from %q: got %d, expected %d", c.url, resp.StatusCode, c.expectedStatus)
+	}
+	return nil
+}
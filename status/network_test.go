@@ -0,0 +1,109 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s S) TestNewCheckCollectionNetwork(c *check.C) {
+	envs := map[string]string{
+		"HOSTCHECK_DNS_NAMES":            "tsuru.example.com, registry.example.com",
+		"HOSTCHECK_TCP_TARGETS":          "registry.example.com:5000",
+		"HOSTCHECK_TCP_TIMEOUT":          "1.5",
+		"HOSTCHECK_HTTP_TARGETS":         "http://tsuru.example.com/healthcheck, http://registry.example.com/v2/|401",
+		"HOSTCHECK_HTTP_EXPECTED_STATUS": "204",
+	}
+	for k, v := range envs {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	checkColl := NewCheckCollection(nil)
+	c.Assert(checkColl.checks, check.DeepEquals, []hostCheck{
+		&writableCheck{path: "/"},
+		&forceErrorCheck{path: "/"},
+		&createContainerCheck{message: "ok"},
+		&dnsCheck{host: "tsuru.example.com", timeout: 5 * time.Second},
+		&dnsCheck{host: "registry.example.com", timeout: 5 * time.Second},
+		&tcpCheck{addr: "registry.example.com:5000", timeout: 1500 * time.Millisecond},
+		&httpCheck{url: "http://tsuru.example.com/healthcheck", expectedStatus: http.StatusNoContent, timeout: 5 * time.Second},
+		&httpCheck{url: "http://registry.example.com/v2/", expectedStatus: http.StatusUnauthorized, timeout: 5 * time.Second},
+	})
+}
+
+func (s S) TestParseHTTPTarget(c *check.C) {
+	tests := []struct {
+		target string
+		url    string
+		status int
+	}{
+		{target: "http://tsuru.example.com/healthcheck", url: "http://tsuru.example.com/healthcheck", status: 200},
+		{target: "http://registry.example.com/v2/|401", url: "http://registry.example.com/v2/", status: 401},
+		{target: "http://example.com/?check=full", url: "http://example.com/?check=full", status: 200},
+		{target: "http://example.com/?check=full|204", url: "http://example.com/?check=full", status: 204},
+		{target: "http://example.com/check?id=404", url: "http://example.com/check?id=404", status: 200},
+		{target: "http://example.com/check?id=404&code=500", url: "http://example.com/check?id=404&code=500", status: 200},
+		{target: "http://example.com/check?id=404|503", url: "http://example.com/check?id=404", status: 503},
+		{target: "http://example.com/|abc", url: "http://example.com/|abc", status: 200},
+	}
+	for _, tt := range tests {
+		u, status := parseHTTPTarget(tt.target, http.StatusOK)
+		c.Check(u, check.Equals, tt.url, check.Commentf("target %q", tt.target))
+		c.Check(status, check.Equals, tt.status, check.Commentf("target %q", tt.target))
+	}
+}
+
+func (s S) TestDNSCheckRun(c *check.C) {
+	hc := &dnsCheck{host: "localhost", timeout: time.Second}
+	c.Assert(hc.Kind(), check.Equals, "dns")
+	c.Assert(hc.Name(), check.Equals, "dns-localhost")
+	c.Assert(hc.Run(), check.IsNil)
+	prev := lookupHost
+	defer func() { lookupHost = prev }()
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return nil, errors.New("no such host")
+	}
+	c.Assert(hc.Run(), check.ErrorMatches, "no such host")
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return nil, nil
+	}
+	c.Assert(hc.Run(), check.ErrorMatches, `no addresses found for "localhost"`)
+}
+
+func (s S) TestTCPCheckRun(c *check.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	addr := l.Addr().String()
+	hc := &tcpCheck{addr: addr, timeout: time.Second}
+	c.Assert(hc.Kind(), check.Equals, "tcp")
+	c.Assert(hc.Name(), check.Equals, "tcp-"+addr)
+	c.Assert(hc.Run(), check.IsNil)
+	l.Close()
+	c.Assert(hc.Run(), check.ErrorMatches, ".*connection refused")
+}
+
+func (s S) TestHTTPCheckRun(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	hc := &httpCheck{url: srv.URL + "/healthcheck", expectedStatus: http.StatusOK, timeout: time.Second}
+	c.Assert(hc.Kind(), check.Equals, "http")
+	c.Assert(hc.Name(), check.Equals, "http-"+srv.URL+"/healthcheck")
+	c.Assert(hc.Run(), check.IsNil)
+	hc.url = srv.URL + "/fail"
+	c.Assert(hc.Run(), check.ErrorMatches, `unexpected status code from ".*/fail": got 503, expected 200`)
+}
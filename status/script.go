@@ -0,0 +1,114 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tsuru/bs/bslog"
+	"github.com/tsuru/bs/config"
+)
+
+// maxScriptOutput is the maximum number of bytes of the output of a failed
+// script reported as the check error.
+const maxScriptOutput = 1024
+
+// scriptChecks returns a check for each executable file in the directory set
+// in HOSTCHECK_SCRIPTS_DIR. Checks share a limit of concurrently running
+// scripts.
+func scriptChecks() []hostCheck {
+	dir := config.StringEnvOrDefault("", "HOSTCHECK_SCRIPTS_DIR")
+	if dir == "" {
+		return nil
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		bslog.Errorf("[host check] unable to list scripts in %q: %s", dir, err)
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	timeout := config.SecondsEnvOrDefault(10, "HOSTCHECK_SCRIPTS_TIMEOUT")
+	concurrency := config.IntEnvOrDefault(2, "HOSTCHECK_SCRIPTS_CONCURRENCY")
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var checks []hostCheck
+	for _, f := range files {
+		if !f.Mode().IsRegular() || f.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		checks = append(checks, &scriptCheck{path: filepath.Join(dir, f.Name()), timeout: timeout, sem: sem})
+	}
+	return checks
+}
+
+type scriptCheck struct {
+	path    string
+	timeout time.Duration
+	sem     chan struct{}
+}
+
+// Kind is derived from the script file name, without extension, so that
+// scripts can be selected in HOSTCHECK_KIND_FILTER.
+func (c *scriptCheck) Kind() string {
+	name := filepath.Base(c.path)
+	return "script-" + strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+func (c *scriptCheck) Name() string {
+	return "script-" + filepath.Base(c.path)
+}
+
+// Run executes the script, which succeeds when it exits with code zero. The
+// trimmed standard output of a failed script is returned as the error.
+func (c *scriptCheck) Run() error {
+	c.sem <- struct{}{}
+	defer func() { <-c.sem }()
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	// The output is written to a file instead of a pipe, as processes
+	// started by the script may keep the pipe open after it is killed.
+	stdout, err := ioutil.TempFile("", "bs-hostcheck-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(stdout.Name())
+	defer stdout.Close()
+	cmd := exec.CommandContext(ctx, c.path)
+	cmd.Stdout = stdout
+	err = cmd.Run()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("script %q timed out after %s", c.path, c.timeout)
+	}
+	data, readErr := ioutil.ReadFile(stdout.Name())
+	if readErr != nil {
+		return fmt.Errorf("script %q failed: %s", c.path, err)
+	}
+	output := strings.TrimSpace(string(data))
+	if output == "" {
+		return fmt.Errorf("script %q failed: %s", c.path, err)
+	}
+	if len(output) > maxScriptOutput {
+		output = output[:maxScriptOutput]
+	}
+	return errors.New(output)
+}
@@ -0,0 +1,102 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func writeScript(c *check.C, dir, name, content string, perm os.FileMode) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+content+"\n"), perm)
+	c.Assert(err, check.IsNil)
+	return path
+}
+
+func (s S) TestNewCheckCollectionScripts(c *check.C) {
+	dir := c.MkDir()
+	writeScript(c, dir, "ntp.sh", "exit 0", 0755)
+	writeScript(c, dir, "docker-storage", "exit 0", 0755)
+	writeScript(c, dir, "README", "not a script", 0644)
+	c.Assert(os.Mkdir(filepath.Join(dir, "subdir"), 0755), check.IsNil)
+	os.Setenv("HOSTCHECK_SCRIPTS_DIR", dir)
+	os.Setenv("HOSTCHECK_SCRIPTS_TIMEOUT", "3")
+	os.Setenv("HOSTCHECK_SCRIPTS_CONCURRENCY", "4")
+	defer os.Unsetenv("HOSTCHECK_SCRIPTS_DIR")
+	defer os.Unsetenv("HOSTCHECK_SCRIPTS_TIMEOUT")
+	defer os.Unsetenv("HOSTCHECK_SCRIPTS_CONCURRENCY")
+	checkColl := NewCheckCollection(nil)
+	c.Assert(checkColl.checks, check.HasLen, 5)
+	first, ok := checkColl.checks[3].(*scriptCheck)
+	c.Assert(ok, check.Equals, true)
+	second, ok := checkColl.checks[4].(*scriptCheck)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(first.path, check.Equals, filepath.Join(dir, "docker-storage"))
+	c.Assert(first.Kind(), check.Equals, "script-docker-storage")
+	c.Assert(second.path, check.Equals, filepath.Join(dir, "ntp.sh"))
+	c.Assert(second.Kind(), check.Equals, "script-ntp")
+	c.Assert(second.Name(), check.Equals, "script-ntp.sh")
+	c.Assert(second.timeout, check.Equals, 3*time.Second)
+	c.Assert(cap(second.sem), check.Equals, 4)
+	c.Assert(first.sem == second.sem, check.Equals, true)
+}
+
+func (s S) TestNewCheckCollectionScriptsInvalidDir(c *check.C) {
+	os.Setenv("HOSTCHECK_SCRIPTS_DIR", filepath.Join(c.MkDir(), "missing"))
+	defer os.Unsetenv("HOSTCHECK_SCRIPTS_DIR")
+	checkColl := NewCheckCollection(nil)
+	c.Assert(checkColl.checks, check.HasLen, 3)
+}
+
+func (s S) TestScriptCheckRun(c *check.C) {
+	dir := c.MkDir()
+	sem := make(chan struct{}, 1)
+	hc := &scriptCheck{path: writeScript(c, dir, "ok.sh", "echo fine", 0755), timeout: time.Second, sem: sem}
+	c.Assert(hc.Run(), check.IsNil)
+	hc.path = writeScript(c, dir, "fail.sh", "echo '  ntp is out of sync  '\nexit 2", 0755)
+	c.Assert(hc.Run(), check.ErrorMatches, "ntp is out of sync")
+	hc.path = writeScript(c, dir, "silent.sh", "exit 3", 0755)
+	c.Assert(hc.Run(), check.ErrorMatches, `script ".*/silent.sh" failed: exit status 3`)
+	hc.path = writeScript(c, dir, "long.sh", "printf '"+strings.Repeat("x", 2*maxScriptOutput)+"'\nexit 1", 0755)
+	err := hc.Run()
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.HasLen, maxScriptOutput)
+	c.Assert(sem, check.HasLen, 0)
+}
+
+func (s S) TestScriptCheckRunTimeout(c *check.C) {
+	dir := c.MkDir()
+	hc := &scriptCheck{path: writeScript(c, dir, "slow.sh", "sleep 10", 0755), timeout: 100 * time.Millisecond, sem: make(chan struct{}, 1)}
+	start := time.Now()
+	c.Assert(hc.Run(), check.ErrorMatches, `script ".*/slow.sh" timed out after 100ms`)
+	c.Assert(time.Since(start) < 5*time.Second, check.Equals, true)
+}
+
+func (s S) TestScriptCheckRunConcurrencyLimit(c *check.C) {
+	dir := c.MkDir()
+	sem := make(chan struct{}, 1)
+	sem <- struct{}{}
+	hc := &scriptCheck{path: writeScript(c, dir, "ok.sh", "exit 0", 0755), timeout: time.Second, sem: sem}
+	done := make(chan error)
+	go func() { done <- hc.Run() }()
+	select {
+	case <-done:
+		c.Fatal("script should wait for a free slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+	<-sem
+	select {
+	case err := <-done:
+		c.Assert(err, check.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for script")
+	}
+}
@@ -9,11 +9,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ajg/form"
@@ -21,6 +23,7 @@ import (
 	"github.com/tsuru/bs/bslog"
 	"github.com/tsuru/bs/container"
 	node "github.com/tsuru/bs/node"
+	"github.com/tsuru/bs/telemetry"
 	"github.com/tsuru/tsuru/provision"
 )
 
@@ -28,6 +31,17 @@ type containerStatus struct {
 	ID     string
 	Name   string
 	Status string
+	// Message is the output of the last healthcheck of units which are not
+	// healthy.
+	Message string `json:",omitempty" form:",omitempty"`
+	// The fields below are only sent in JSON payloads.
+	RestartCount int        `form:"-"`
+	ExitCode     int        `form:"-"`
+	OOMKilled    bool       `form:"-"`
+	StartedAt    *time.Time `json:",omitempty" form:"-"`
+	FinishedAt   *time.Time `json:",omitempty" form:"-"`
+	Image        string     `json:",omitempty" form:"-"`
+	ProcessName  string     `json:",omitempty" form:"-"`
 }
 
 type respUnit struct {
@@ -41,24 +55,61 @@ type ReporterConfig struct {
 	TsuruEndpoint  string
 	TsuruToken     string
 	Kubernetes     bool
+	// PayloadFormat is the format of the status sent to the tsuru API:
+	// PayloadForm, PayloadJSON or PayloadAuto, the default, which sends
+	// JSON once the tsuru API advertises support for it.
+	PayloadFormat string
+	// Events enables immediate unit status updates on Docker container
+	// events, sent after EventsDebounce without further events.
+	Events         bool
+	EventsDebounce time.Duration
+	// Zombie holds the policy applied to containers not known by tsuru.
+	Zombie ZombiePolicy
+	// InfoClient, when set, is used to inspect containers and watch their
+	// events, sharing the events stream with the log forwarder. Otherwise,
+	// the reporter creates its own client.
+	InfoClient *container.InfoClient
 }
 
 type Reporter struct {
 	config     *ReporterConfig
 	abort      chan<- struct{}
 	exit       <-chan struct{}
+	reload     chan time.Duration
 	checks     *checkCollection
 	addrs      []string
 	infoClient *container.InfoClient
+	ownsClient bool
 	httpClient *http.Client
 	mu         sync.Mutex
 	removeMap  map[string]chan struct{}
+	jsonOK     int32
+	zombies    map[string]int
+	lastMu     sync.RWMutex
+	lastReport *ReportState
+	pendingMu  sync.Mutex
+	pending    map[string]struct{}
+	unitEvents chan struct{}
+	reconcile  chan struct{}
+	eventsWg   sync.WaitGroup
+	started    time.Time
+	interval   int64
+}
+
+// ReportState describes the last status report sent to the tsuru API.
+type ReportState struct {
+	Time    time.Time
+	Addrs   []string
+	Units   []containerStatus
+	Checks  []HostCheckResult
+	Zombies []ZombieState
+	Err     string
 }
 
 type hostStatus struct {
 	Addrs  []string
 	Units  []containerStatus
-	Checks []hostCheckResult
+	Checks []HostCheckResult
 }
 
 const (
@@ -66,8 +117,23 @@ const (
 	fullTimeout = 1 * time.Minute
 )
 
+// staleReportIntervals is the number of report intervals without a status
+// report after which the reporter is considered stalled.
+const staleReportIntervals = 3
+
+const (
+	PayloadAuto = "auto"
+	PayloadForm = "form"
+	PayloadJSON = "json"
+)
+
 var errRouteNotFound = errors.New("route not found")
 
+var (
+	reports      = telemetry.NewCounter("bs_status_reports")
+	reportErrors = telemetry.NewCounter("bs_status_report_errors")
+)
+
 // NewReporter starts the status reporter. It will run intermitently, sending a
 // message in the exit channel in case it exits. It's possible to arbitrarily
 // interrupt the reporter by sending a message in the abort channel.
@@ -77,9 +143,14 @@ func NewReporter(config *ReporterConfig) (*Reporter, error) {
 	}
 	abort := make(chan struct{})
 	exit := make(chan struct{})
-	infoClient, err := container.NewClient(config.DockerEndpoint)
-	if err != nil {
-		return nil, err
+	infoClient := config.InfoClient
+	ownsClient := infoClient == nil
+	if ownsClient {
+		var err error
+		infoClient, err = container.NewClient(config.DockerEndpoint)
+		if err != nil {
+			return nil, err
+		}
 	}
 	checks := NewCheckCollection(infoClient.GetClient())
 	addrs, err := node.GetNodeAddrs()
@@ -98,29 +169,68 @@ func NewReporter(config *ReporterConfig) (*Reporter, error) {
 		config:     config,
 		abort:      abort,
 		exit:       exit,
+		reload:     make(chan time.Duration, 1),
 		infoClient: infoClient,
+		ownsClient: ownsClient,
 		checks:     checks,
 		addrs:      addrs,
 		httpClient: &http.Client{
 			Transport: &transport,
 			Timeout:   fullTimeout,
 		},
-		removeMap: make(map[string]chan struct{}),
+		removeMap:  make(map[string]chan struct{}),
+		zombies:    make(map[string]int),
+		pending:    make(map[string]struct{}),
+		unitEvents: make(chan struct{}, 1),
+		reconcile:  make(chan struct{}, 1),
+		started:    time.Now(),
+		interval:   int64(config.Interval),
+	}
+	if config.Events && !config.Kubernetes {
+		reporter.watchEvents(abort)
 	}
 	go func(abort <-chan struct{}) {
 		for {
 			reporter.reportStatus()
 			select {
 			case <-abort:
+				if reporter.ownsClient {
+					reporter.infoClient.StopWatchingEvents()
+				}
+				reporter.eventsWg.Wait()
 				close(exit)
 				return
 			case <-time.After(reporter.config.Interval):
+			case <-reporter.reconcile:
+			case interval := <-reporter.reload:
+				reporter.config.Interval = interval
+				atomic.StoreInt64(&reporter.interval, int64(interval))
+				reporter.reloadChecks()
 			}
 		}
 	}(abort)
 	return &reporter, nil
 }
 
+// Reload changes the interval between status reports and reloads the host
+// checks configuration, a new report is sent right away.
+func (r *Reporter) Reload(interval time.Duration) {
+	select {
+	case <-r.reload:
+	default:
+	}
+	r.reload <- interval
+}
+
+func (r *Reporter) reloadChecks() {
+	checks := NewCheckCollection(r.infoClient.GetClient())
+	// Checks still running after a timeout will report their result in
+	// the same channels.
+	checks.errChannels = r.checks.errChannels
+	checks.history = r.checks.history
+	r.checks = checks
+}
+
 // Stop stops the reporter. It will block until it actually stops (i.e. there's
 // no need to call Wait after calling Stop).
 func (r *Reporter) Stop() {
@@ -133,22 +243,87 @@ func (r *Reporter) Wait() {
 	<-r.exit
 }
 
+// LastReport returns the last status report sent to the tsuru API, or nil
+// if no report was sent yet.
+func (r *Reporter) LastReport() *ReportState {
+	r.lastMu.RLock()
+	defer r.lastMu.RUnlock()
+	return r.lastReport
+}
+
+// Healthy returns an error if the last status report failed, e.g. because
+// the Docker or the tsuru API were unreachable, or if no report was sent in
+// the last few intervals.
+func (r *Reporter) Healthy() error {
+	since := r.started
+	if last := r.LastReport(); last != nil {
+		if last.Err != "" {
+			return fmt.Errorf("last status report failed: %s", last.Err)
+		}
+		since = last.Time
+	}
+	interval := time.Duration(atomic.LoadInt64(&r.interval))
+	if age := time.Since(since); age > staleReportIntervals*interval+fullTimeout {
+		return fmt.Errorf("no status report sent in the last %v", age.Round(time.Second))
+	}
+	return nil
+}
+
+// LastHostChecks returns the results of the host checks run in the last
+// status report.
+func (r *Reporter) LastHostChecks() []HostCheckResult {
+	last := r.LastReport()
+	if last == nil {
+		return []HostCheckResult{}
+	}
+	return last.Checks
+}
+
+func (r *Reporter) setLastReport(hostData *hostStatus, zombies []ZombieState, err error) {
+	state := &ReportState{
+		Time:    time.Now(),
+		Addrs:   hostData.Addrs,
+		Units:   hostData.Units,
+		Checks:  hostData.Checks,
+		Zombies: zombies,
+	}
+	if err != nil {
+		state.Err = err.Error()
+	}
+	r.lastMu.Lock()
+	r.lastReport = state
+	r.lastMu.Unlock()
+}
+
 func (r *Reporter) reportStatus() {
+	reports.Inc()
 	hostChecks := r.checks.Run()
 	hostData := &hostStatus{
 		Addrs:  r.addrs,
 		Checks: hostChecks,
 	}
+	var err error
+	var zombies []ZombieState
+	defer func() {
+		r.setLastReport(hostData, zombies, err)
+	}()
+	var listed map[string]docker.APIContainers
 
 	if !r.config.Kubernetes {
 		client := r.infoClient.GetClient()
 		opts := docker.ListContainersOptions{All: true}
-		containers, err := client.ListContainers(opts)
+		var containers []docker.APIContainers
+		containers, err = client.ListContainers(opts)
 		if err != nil {
+			reportErrors.Inc()
 			bslog.Errorf("[status reporter] failed to list containers in the Docker server at %q: %s", r.config.DockerEndpoint, err)
 			return
 		}
 		hostData.Units = r.retrieveContainerStatuses(containers)
+		listed = make(map[string]docker.APIContainers, len(containers))
+		for _, c := range containers {
+			listed[c.ID] = c
+		}
 	}
 
 	resp, err := r.updateNode(hostData)
@@ -156,11 +331,13 @@ func (r *Reporter) reportStatus() {
 		resp, err = r.updateUnits(hostData.Units)
 	}
 	if err != nil {
+		reportErrors.Inc()
 		bslog.Errorf("[status reporter] failed to send data to the tsuru server at %q: %s", r.config.TsuruEndpoint, err)
 		return
 	}
-	err = r.handleTsuruResponse(resp)
+	zombies, err = r.handleTsuruResponse(resp, listed)
 	if err != nil {
+		reportErrors.Inc()
 		bslog.Errorf("[status reporter] failed to handle tsuru response: %s", err)
 	}
 }
@@ -172,7 +349,6 @@ func (r *Reporter) retrieveContainerStatuses(containers []docker.APIContainers)
 		if len(c.Names) > 0 {
 			name = strings.TrimPrefix(c.Names[0], "/")
 		}
-		var status provision.Status
 		cont, err := r.infoClient.GetAppContainer(c.ID, false)
 		if err == container.ErrTsuruVariablesNotFound {
 			continue
@@ -181,50 +357,146 @@ func (r *Reporter) retrieveContainerStatuses(containers []docker.APIContainers)
 			bslog.Errorf("[status reporter] failed to inspect container %q (%s): %s", c.ID, name, err)
 			continue
 		}
-		if cont != nil && cont.IsIsolated() {
+		if name == "" {
+			name = strings.TrimPrefix(cont.Name, "/")
+		}
+		if cont.IsIsolated() {
 			continue
 		}
-		if cont.Container.State.Restarting ||
-			cont.Container.State.Dead ||
-			cont.Container.State.RemovalInProgress {
-			status = provision.StatusError
-		} else if cont.Container.State.Running {
-			status = provision.StatusStarted
-		} else if cont.Container.State.StartedAt.IsZero() {
-			status = provision.StatusCreated
-		} else {
-			status = provision.StatusStopped
+		status, message := unitStatus(&cont.Container.State)
+		unit := containerStatus{
+			ID:           c.ID,
+			Name:         name,
+			Status:       status.String(),
+			Message:      message,
+			RestartCount: cont.RestartCount,
+			ExitCode:     cont.State.ExitCode,
+			OOMKilled:    cont.State.OOMKilled,
+			Image:        cont.Image,
+			ProcessName:  cont.ProcessName,
 		}
-		statuses = append(statuses, containerStatus{ID: c.ID, Name: name, Status: status.String()})
+		if !cont.State.StartedAt.IsZero() {
+			startedAt := cont.State.StartedAt
+			unit.StartedAt = &startedAt
+		}
+		if !cont.State.FinishedAt.IsZero() {
+			finishedAt := cont.State.FinishedAt
+			unit.FinishedAt = &finishedAt
+		}
+		statuses = append(statuses, unit)
 	}
 	return statuses
 }
 
+// unitStatus returns the status of a unit given the state of its container,
+// along with the output of the last healthcheck for running containers
+// which are not healthy.
+func unitStatus(state *docker.State) (provision.Status, string) {
+	if state.Restarting || state.Dead || state.RemovalInProgress {
+		return provision.StatusError, ""
+	}
+	if !state.Running {
+		if state.StartedAt.IsZero() {
+			return provision.StatusCreated, ""
+		}
+		return provision.StatusStopped, ""
+	}
+	var message string
+	if n := len(state.Health.Log); n > 0 {
+		message = strings.TrimSpace(state.Health.Log[n-1].Output)
+	}
+	switch state.Health.Status {
+	case "unhealthy":
+		return provision.StatusError, message
+	case "starting":
+		return provision.StatusStarting, message
+	}
+	return provision.StatusStarted, ""
+}
+
+// useJSON reports whether the status is sent as JSON, which carries more
+// details about each unit.
+func (r *Reporter) useJSON() bool {
+	switch r.config.PayloadFormat {
+	case PayloadJSON:
+		return true
+	case PayloadForm:
+		return false
+	}
+	return atomic.LoadInt32(&r.jsonOK) == 1
+}
+
 func (r *Reporter) updateNode(payload *hostStatus) (*http.Response, error) {
-	bodyContent, err := form.EncodeToString(payload)
-	if err != nil {
-		return nil, err
+	useJSON := r.useJSON()
+	var body io.Reader
+	contentType := "application/x-www-form-urlencoded"
+	if useJSON {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	} else {
+		bodyContent, err := form.EncodeToString(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(bodyContent)
 	}
 	url := fmt.Sprintf("%s/node/status", strings.TrimRight(r.config.TsuruEndpoint, "/"))
-	request, err := http.NewRequest("POST", url, strings.NewReader(bodyContent))
+	request, err := http.NewRequest("POST", url, body)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Add("Content-Type", contentType)
 	request.Header.Add("Authorization", "bearer "+r.config.TsuruToken)
 	resp, err := r.httpClient.Do(request)
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
 		return nil, errRouteNotFound
 	}
+	if r.config.PayloadFormat == PayloadJSON || r.config.PayloadFormat == PayloadForm {
+		return resp, nil
+	}
+	if useJSON && resp.StatusCode == http.StatusUnsupportedMediaType {
+		resp.Body.Close()
+		atomic.StoreInt32(&r.jsonOK, 0)
+		return r.updateNode(payload)
+	}
+	var jsonOK int32
+	if acceptsJSON(resp.Header) {
+		jsonOK = 1
+	}
+	atomic.StoreInt32(&r.jsonOK, jsonOK)
 	return resp, nil
 }
 
+// acceptsJSON reports whether the tsuru API advertises support for JSON
+// payloads, listing application/json in the Accept-Post header.
+func acceptsJSON(header http.Header) bool {
+	for _, value := range header["Accept-Post"] {
+		for _, mediaType := range strings.Split(value, ",") {
+			if strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0]) == "application/json" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updateUnits sends the status of the units to the legacy units endpoint,
+// which only knows the basic unit fields.
 func (r *Reporter) updateUnits(payload []containerStatus) (*http.Response, error) {
+	units := make([]containerStatus, len(payload))
+	for i, unit := range payload {
+		units[i] = containerStatus{ID: unit.ID, Name: unit.Name, Status: unit.Status, Message: unit.Message}
+	}
 	var body bytes.Buffer
-	err := json.NewEncoder(&body).Encode(payload)
+	err := json.NewEncoder(&body).Encode(units)
 	if err != nil {
 		return nil, err
 	}
@@ -258,13 +530,25 @@ func (r *Reporter) tryRemoveContainer(id string) {
 			delete(r.removeMap, id)
 			r.mu.Unlock()
 		}()
-		bslog.Warnf("[status reporter] removing container %q not found in tsuru response", id)
 		client := r.infoClient.GetClient()
+		if r.config.Zombie.Stop {
+			bslog.Warnf("[status reporter] stopping container %q not found in tsuru response", id)
+			err := client.StopContainer(id, zombieStopTimeout)
+			if err != nil {
+				bslog.Errorf("[status reporter] failed to stop invalid container %q: %s", id, err)
+				return
+			}
+			zombiesRemoved.Inc()
+			return
+		}
+		bslog.Warnf("[status reporter] removing container %q not found in tsuru response", id)
 		opts := docker.RemoveContainerOptions{ID: id, Force: true}
 		err := client.RemoveContainer(opts)
 		if err != nil {
 			bslog.Errorf("[status reporter] failed to remove invalid container %q: %s", id, err)
+			return
 		}
+		zombiesRemoved.Inc()
 	}()
 }
 
@@ -276,24 +560,23 @@ func (r *Reporter) waitPendingRemovals() {
 	}
 }
 
-func (r *Reporter) handleTsuruResponse(resp *http.Response) error {
+// handleTsuruResponse checks the units in tsuru response, applying the
+// zombie policy to the containers not found by tsuru. Listed holds every
+// container in the host, it's nil for reports of a subset of the units,
+// which don't take part in zombie detection.
+func (r *Reporter) handleTsuruResponse(resp *http.Response, listed map[string]docker.APIContainers) ([]ZombieState, error) {
 	var statusResp []respUnit
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected response from tsuru %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("unexpected response from tsuru %d: %s", resp.StatusCode, string(body))
 	}
-	if r.config.Kubernetes {
-		return nil
+	if r.config.Kubernetes || listed == nil {
+		return nil, nil
 	}
 	err := json.NewDecoder(resp.Body).Decode(&statusResp)
 	if err != nil {
-		return fmt.Errorf("unable to parse tsuru response: %s", err)
-	}
-	for _, unit := range statusResp {
-		if !unit.Found {
-			r.tryRemoveContainer(unit.ID)
-		}
+		return nil, fmt.Errorf("unable to parse tsuru response: %s", err)
 	}
-	return nil
+	return r.handleZombies(statusResp, listed), nil
 }
@@ -15,6 +15,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"sort"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -155,6 +156,77 @@ func (s S) TestReportStatusOnKubernetes(c *check.C) {
 	c.Assert(input, check.DeepEquals, expected)
 }
 
+func (s S) TestReportStatusLastReport(c *check.C) {
+	bslog.Logger = log.New(ioutil.Discard, "", 0)
+	var resp http.Response
+	resp.StatusCode = http.StatusInternalServerError
+	resp.Body = ioutil.NopCloser(bytes.NewBufferString("something went wrong"))
+	tsuruServer, requests := s.startTsuruServer(&resp)
+	defer tsuruServer.Close()
+	dockerServer, _ := s.startDockerServer(nil, nil, c)
+	defer dockerServer.Stop()
+	reporter, err := NewReporter(&ReporterConfig{
+		Interval:       10 * time.Minute,
+		TsuruEndpoint:  tsuruServer.URL,
+		DockerEndpoint: dockerServer.URL(),
+		TsuruToken:     "some-token",
+		Kubernetes:     true,
+	})
+	c.Assert(err, check.IsNil)
+	reporter.Stop()
+	<-requests
+	last := reporter.LastReport()
+	c.Assert(last, check.NotNil)
+	c.Assert(last.Err, check.Not(check.Equals), "")
+	c.Assert(last.Checks, check.HasLen, 3)
+	c.Assert(len(last.Addrs) > 0, check.Equals, true)
+	c.Assert(reporter.LastHostChecks(), check.DeepEquals, last.Checks)
+}
+
+func (s S) TestReporterHealthy(c *check.C) {
+	reporter := &Reporter{started: time.Now(), interval: int64(time.Minute)}
+	c.Assert(reporter.Healthy(), check.IsNil)
+	reporter.started = time.Now().Add(-10 * time.Minute)
+	c.Assert(reporter.Healthy(), check.ErrorMatches, `no status report sent in the last 10m0s`)
+	reporter.lastReport = &ReportState{Time: time.Now()}
+	c.Assert(reporter.Healthy(), check.IsNil)
+	reporter.lastReport = &ReportState{Time: time.Now(), Err: "connection refused"}
+	c.Assert(reporter.Healthy(), check.ErrorMatches, "last status report failed: connection refused")
+}
+
+func (s S) TestReporterReload(c *check.C) {
+	bslog.Logger = log.New(ioutil.Discard, "", 0)
+	var resp http.Response
+	resp.StatusCode = http.StatusInternalServerError
+	resp.Body = ioutil.NopCloser(bytes.NewBufferString("something went wrong"))
+	tsuruServer, requests := s.startTsuruServer(&resp)
+	defer tsuruServer.Close()
+	dockerServer, _ := s.startDockerServer(nil, nil, c)
+	defer dockerServer.Stop()
+	reporter, err := NewReporter(&ReporterConfig{
+		Interval:       10 * time.Minute,
+		TsuruEndpoint:  tsuruServer.URL,
+		DockerEndpoint: dockerServer.URL(),
+		TsuruToken:     "some-token",
+		Kubernetes:     true,
+	})
+	c.Assert(err, check.IsNil)
+	<-requests
+	os.Setenv("HOSTCHECK_KIND_FILTER", "writablePath")
+	defer os.Unsetenv("HOSTCHECK_KIND_FILTER")
+	reporter.Reload(5 * time.Minute)
+	select {
+	case <-requests:
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for status report after reload")
+	}
+	reporter.Stop()
+	c.Assert(reporter.config.Interval, check.Equals, 5*time.Minute)
+	checks := reporter.LastHostChecks()
+	c.Assert(checks, check.HasLen, 1)
+	c.Assert(checks[0].Name, check.Equals, "writablePath-/")
+}
+
 func (s S) TestReportStatus404OnHostStatus(c *check.C) {
 	var logOutput bytes.Buffer
 	bslog.Logger = log.New(&logOutput, "", 0)
@@ -342,3 +414,168 @@ func (S) startDockerServer(containers []bogusContainer, hook func(*http.Request)
 	}
 	return server, createdContainers
 }
+
+func (s S) TestUnitStatus(c *check.C) {
+	started := time.Now().Add(-time.Hour)
+	tests := []struct {
+		state   docker.State
+		status  string
+		message string
+	}{
+		{state: docker.State{}, status: "created"},
+		{state: docker.State{StartedAt: started}, status: "stopped"},
+		{state: docker.State{Running: true, Restarting: true}, status: "error"},
+		{state: docker.State{Running: true}, status: "started"},
+		{state: docker.State{Running: true, Health: docker.Health{Status: "healthy", Log: []docker.HealthCheck{{Output: "ok"}}}}, status: "started"},
+		{state: docker.State{Running: true, Health: docker.Health{Status: "starting"}}, status: "starting"},
+		{state: docker.State{Running: true, Health: docker.Health{Status: "unhealthy", Log: []docker.HealthCheck{
+			{Output: "old failure"},
+			{ExitCode: 1, Output: "connection refused\n"},
+		}}}, status: "error", message: "connection refused"},
+		{state: docker.State{StartedAt: started, Health: docker.Health{Status: "unhealthy", Log: []docker.HealthCheck{{Output: "failure"}}}}, status: "stopped"},
+	}
+	for i, tt := range tests {
+		status, message := unitStatus(&tt.state)
+		c.Check(status.String(), check.Equals, tt.status, check.Commentf("test %d", i))
+		c.Check(message, check.Equals, tt.message, check.Commentf("test %d", i))
+	}
+}
+
+func (s S) TestReportStatusHealth(c *check.C) {
+	bslog.Logger = log.New(ioutil.Discard, "", 0)
+	bogusContainers := []bogusContainer{
+		{name: "x1", config: docker.Config{Image: "tsuru/python", Env: []string{"TSURU_APPNAME=someapp"}}, state: docker.State{Running: true, Health: docker.Health{Status: "unhealthy", Log: []docker.HealthCheck{{ExitCode: 1, Output: "HTTP 500"}}}}},
+		{name: "x2", config: docker.Config{Image: "tsuru/python", Env: []string{"TSURU_APPNAME=someapp"}}, state: docker.State{Running: true, Health: docker.Health{Status: "healthy"}}},
+	}
+	dockerServer, containers := s.startDockerServer(bogusContainers, nil, c)
+	defer dockerServer.Stop()
+	tsuruServer, requests := s.startTsuruServer(func(*http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString("[]"))}
+	})
+	defer tsuruServer.Close()
+	reporter, err := NewReporter(&ReporterConfig{
+		Interval:       10 * time.Minute,
+		DockerEndpoint: dockerServer.URL(),
+		TsuruEndpoint:  tsuruServer.URL,
+		TsuruToken:     "some-token",
+	})
+	c.Assert(err, check.IsNil)
+	reporter.Stop()
+	req := <-requests
+	c.Assert(strings.Count(string(req.body), "Message="), check.Equals, 1)
+	var input hostStatus
+	err = form.DecodeString(&input, string(req.body))
+	c.Assert(err, check.IsNil)
+	sort.Slice(input.Units, func(i, j int) bool {
+		return input.Units[i].Name < input.Units[j].Name
+	})
+	c.Assert(input.Units, check.DeepEquals, []containerStatus{
+		{ID: containers[0].ID, Name: "x1", Status: "error", Message: "HTTP 500"},
+		{ID: containers[1].ID, Name: "x2", Status: "started"},
+	})
+}
+
+func (s S) TestReportStatusJSONPayload(c *check.C) {
+	bslog.Logger = log.New(ioutil.Discard, "", 0)
+	finished := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	started := finished.Add(-time.Hour)
+	bogusContainers := []bogusContainer{
+		{name: "x1", config: docker.Config{Image: "tsuru/python", Env: []string{"TSURU_APPNAME=someapp", "TSURU_PROCESSNAME=web"}}, state: docker.State{ExitCode: 137, OOMKilled: true, StartedAt: started, FinishedAt: finished}},
+	}
+	dockerServer, containers := s.startDockerServer(bogusContainers, nil, c)
+	defer dockerServer.Stop()
+	var unsupported, unadvertised int32
+	tsuruServer, requests := s.startTsuruServer(func(r *http.Request) *http.Response {
+		resp := &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString("[]")), Header: http.Header{}}
+		if r.Header.Get("Content-Type") == "application/json" && atomic.LoadInt32(&unsupported) == 1 {
+			resp.StatusCode = http.StatusUnsupportedMediaType
+			return resp
+		}
+		if atomic.LoadInt32(&unadvertised) == 0 {
+			resp.Header.Set("Accept-Post", "application/x-www-form-urlencoded, application/json; charset=utf-8")
+		}
+		return resp
+	})
+	defer tsuruServer.Close()
+	reporter, err := NewReporter(&ReporterConfig{
+		Interval:       10 * time.Minute,
+		DockerEndpoint: dockerServer.URL(),
+		TsuruEndpoint:  tsuruServer.URL,
+		TsuruToken:     "some-token",
+	})
+	c.Assert(err, check.IsNil)
+	reporter.Stop()
+	req := <-requests
+	c.Assert(req.request.Header.Get("Content-Type"), check.Equals, "application/x-www-form-urlencoded")
+	c.Assert(strings.Contains(string(req.body), "ExitCode"), check.Equals, false)
+	reporter.reportStatus()
+	req = <-requests
+	c.Assert(req.request.Header.Get("Content-Type"), check.Equals, "application/json")
+	var input hostStatus
+	err = json.Unmarshal(req.body, &input)
+	c.Assert(err, check.IsNil)
+	c.Assert(input.Checks, check.HasLen, 3)
+	c.Assert(input.Units, check.HasLen, 1)
+	unit := input.Units[0]
+	c.Assert(unit.StartedAt, check.NotNil)
+	c.Assert(unit.StartedAt.Equal(started), check.Equals, true)
+	c.Assert(unit.FinishedAt, check.NotNil)
+	c.Assert(unit.FinishedAt.Equal(finished), check.Equals, true)
+	unit.StartedAt, unit.FinishedAt = nil, nil
+	c.Assert(unit, check.DeepEquals, containerStatus{
+		ID:          containers[0].ID,
+		Name:        "x1",
+		Status:      "stopped",
+		ExitCode:    137,
+		OOMKilled:   true,
+		Image:       containers[0].Image,
+		ProcessName: "web",
+	})
+	atomic.StoreInt32(&unsupported, 1)
+	reporter.reportStatus()
+	req = <-requests
+	c.Assert(req.request.Header.Get("Content-Type"), check.Equals, "application/json")
+	req = <-requests
+	c.Assert(req.request.Header.Get("Content-Type"), check.Equals, "application/x-www-form-urlencoded")
+	c.Assert(reporter.LastReport().Err, check.Equals, "")
+	atomic.StoreInt32(&unsupported, 0)
+	atomic.StoreInt32(&unadvertised, 1)
+	reporter.reportStatus()
+	req = <-requests
+	c.Assert(req.request.Header.Get("Content-Type"), check.Equals, "application/json")
+	reporter.reportStatus()
+	req = <-requests
+	c.Assert(req.request.Header.Get("Content-Type"), check.Equals, "application/x-www-form-urlencoded")
+}
+
+func (s S) TestReportStatusPayloadFormat(c *check.C) {
+	bslog.Logger = log.New(ioutil.Discard, "", 0)
+	dockerServer, _ := s.startDockerServer(nil, nil, c)
+	defer dockerServer.Stop()
+	tsuruServer, requests := s.startTsuruServer(func(r *http.Request) *http.Response {
+		resp := &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString("[]")), Header: http.Header{}}
+		resp.Header.Set("Accept-Post", "application/json")
+		return resp
+	})
+	defer tsuruServer.Close()
+	for format, contentTypes := range map[string][]string{
+		PayloadJSON: {"application/json", "application/json"},
+		PayloadForm: {"application/x-www-form-urlencoded", "application/x-www-form-urlencoded"},
+		PayloadAuto: {"application/x-www-form-urlencoded", "application/json"},
+	} {
+		reporter, err := NewReporter(&ReporterConfig{
+			Interval:       10 * time.Minute,
+			DockerEndpoint: dockerServer.URL(),
+			TsuruEndpoint:  tsuruServer.URL,
+			TsuruToken:     "some-token",
+			PayloadFormat:  format,
+		})
+		c.Assert(err, check.IsNil)
+		reporter.Stop()
+		reporter.reportStatus()
+		for _, contentType := range contentTypes {
+			req := <-requests
+			c.Check(req.request.Header.Get("Content-Type"), check.Equals, contentType, check.Commentf("format %s", format))
+		}
+	}
+}
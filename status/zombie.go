@@ -0,0 +1,117 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"sort"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/bs/bslog"
+	"github.com/tsuru/bs/telemetry"
+)
+
+// zombieStopTimeout is the number of seconds to wait for a zombie container
+// to stop before killing it.
+const zombieStopTimeout = 10
+
+const (
+	zombieWaiting  = "waiting"
+	zombieCapped   = "capped"
+	zombieDryRun   = "dry-run"
+	zombieRemoving = "removing"
+	zombieStopping = "stopping"
+	zombieStopped  = "stopped"
+)
+
+var zombiesRemoved = telemetry.NewCounter("bs_status_zombies_removed")
+
+// ZombiePolicy controls how containers reported as not found by tsuru, known
+// as zombies, are handled. The zero value removes zombies right away.
+type ZombiePolicy struct {
+	// Cycles is the number of consecutive status reports in which a
+	// container must be reported as not found before being removed.
+	Cycles int
+	// MinAge is the minimum age of a container before being removed.
+	MinAge time.Duration
+	// MaxRemovals is the maximum number of containers removed on each status
+	// report, zero meaning no limit.
+	MaxRemovals int
+	// DryRun only logs and reports the containers that would be removed.
+	DryRun bool
+	// Stop stops zombie containers instead of removing them.
+	Stop bool
+}
+
+// ZombieState describes a container not found by tsuru in the last status
+// report, along with the action taken.
+type ZombieState struct {
+	ID     string
+	Cycles int
+	Action string
+}
+
+// handleZombies tracks the containers not found by tsuru in consecutive
+// status reports, removing the ones allowed by the zombie policy. When
+// zombies are stopped, the ones already stopped are reported as such without
+// counting against the limit of removals.
+func (r *Reporter) handleZombies(units []respUnit, listed map[string]docker.APIContainers) []ZombieState {
+	policy := r.config.Zombie
+	r.mu.Lock()
+	cycles := make(map[string]int)
+	for _, unit := range units {
+		if !unit.Found {
+			cycles[unit.ID] = r.zombies[unit.ID] + 1
+		}
+	}
+	r.zombies = cycles
+	r.mu.Unlock()
+	ids := make([]string, 0, len(cycles))
+	for id := range cycles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	states := make([]ZombieState, 0, len(ids))
+	var removals int
+	for _, id := range ids {
+		state := ZombieState{ID: id, Cycles: cycles[id]}
+		cont, known := listed[id]
+		switch {
+		case policy.Stop && known && isStoppedState(cont.State):
+			state.Action = zombieStopped
+		case state.Cycles < policy.Cycles,
+			policy.MinAge > 0 && (!known || time.Since(time.Unix(cont.Created, 0)) < policy.MinAge):
+			state.Action = zombieWaiting
+		case policy.MaxRemovals > 0 && removals >= policy.MaxRemovals:
+			state.Action = zombieCapped
+			bslog.Warnf("[status reporter] not removing container %q not found in tsuru response: limit of %d removals per report reached", id, policy.MaxRemovals)
+		case policy.DryRun:
+			removals++
+			state.Action = zombieDryRun
+			bslog.Warnf("[status reporter] dry-run: would remove container %q not found in tsuru response for %d reports", id, state.Cycles)
+		default:
+			removals++
+			// The removal runs in the background, its result is only logged.
+			state.Action = zombieRemoving
+			if policy.Stop {
+				state.Action = zombieStopping
+			}
+			r.tryRemoveContainer(id)
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// isStoppedState reports whether the state of a listed container is one of
+// the states of containers not running. The state isn't set by older Docker
+// API versions.
+func isStoppedState(state string) bool {
+	switch state {
+	case "created", "exited", "dead":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/bs/bslog"
+	"gopkg.in/check.v1"
+)
+
+func (s S) startZombieReporter(c *check.C, policy ZombiePolicy, hook func(*http.Request)) (*Reporter, []string, func()) {
+	bslog.Logger = log.New(ioutil.Discard, "", 0)
+	bogusContainers := []bogusContainer{
+		{name: "x1", config: docker.Config{Image: "tsuru/python"}, state: docker.State{Running: true}},
+		{name: "x2", config: docker.Config{Image: "tsuru/python"}, state: docker.State{Running: true}},
+		{name: "x3", config: docker.Config{Image: "tsuru/python"}, state: docker.State{Running: true}},
+	}
+	dockerServer, conts := s.startDockerServer(bogusContainers, hook, c)
+	var statusResp []respUnit
+	ids := make([]string, len(conts))
+	for i, cont := range conts {
+		ids[i] = cont.ID
+		statusResp = append(statusResp, respUnit{ID: cont.ID, Found: false})
+	}
+	sort.Strings(ids)
+	data, err := json.Marshal(statusResp)
+	c.Assert(err, check.IsNil)
+	tsuruServer, _ := s.startTsuruServer(func(*http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBuffer(data))}
+	})
+	reporter, err := NewReporter(&ReporterConfig{
+		Interval:       10 * time.Minute,
+		DockerEndpoint: dockerServer.URL(),
+		TsuruEndpoint:  tsuruServer.URL,
+		TsuruToken:     "some-token",
+		Zombie:         policy,
+	})
+	c.Assert(err, check.IsNil)
+	reporter.Stop()
+	// Discards the effects of the first report, sent when the reporter
+	// starts.
+	reporter.waitPendingRemovals()
+	reporter.zombies = make(map[string]int)
+	return reporter, ids, func() {
+		tsuruServer.Close()
+		dockerServer.Stop()
+	}
+}
+
+func (s S) TestReportStatusZombieCyclesAndCap(c *check.C) {
+	var deleteCount int32
+	reporter, ids, cleanup := s.startZombieReporter(c, ZombiePolicy{Cycles: 2, MaxRemovals: 1}, func(r *http.Request) {
+		if r.Method == "DELETE" {
+			atomic.AddInt32(&deleteCount, 1)
+		}
+	})
+	defer cleanup()
+	reporter.reportStatus()
+	reporter.waitPendingRemovals()
+	c.Assert(atomic.LoadInt32(&deleteCount), check.Equals, int32(0))
+	c.Assert(reporter.LastReport().Zombies, check.DeepEquals, []ZombieState{
+		{ID: ids[0], Cycles: 1, Action: "waiting"},
+		{ID: ids[1], Cycles: 1, Action: "waiting"},
+		{ID: ids[2], Cycles: 1, Action: "waiting"},
+	})
+	reporter.reportStatus()
+	reporter.waitPendingRemovals()
+	c.Assert(atomic.LoadInt32(&deleteCount), check.Equals, int32(1))
+	c.Assert(reporter.LastReport().Zombies, check.DeepEquals, []ZombieState{
+		{ID: ids[0], Cycles: 2, Action: "removing"},
+		{ID: ids[1], Cycles: 2, Action: "capped"},
+		{ID: ids[2], Cycles: 2, Action: "capped"},
+	})
+}
+
+func (s S) TestReportStatusZombieMinAge(c *check.C) {
+	var deleteCount int32
+	reporter, ids, cleanup := s.startZombieReporter(c, ZombiePolicy{MinAge: time.Hour}, func(r *http.Request) {
+		if r.Method == "DELETE" {
+			atomic.AddInt32(&deleteCount, 1)
+		}
+	})
+	defer cleanup()
+	reporter.reportStatus()
+	reporter.waitPendingRemovals()
+	c.Assert(atomic.LoadInt32(&deleteCount), check.Equals, int32(0))
+	zombies := reporter.LastReport().Zombies
+	c.Assert(zombies, check.HasLen, len(ids))
+	for _, z := range zombies {
+		c.Check(z.Action, check.Equals, "waiting")
+	}
+}
+
+func (s S) TestReportStatusZombieDryRun(c *check.C) {
+	var deleteCount int32
+	reporter, ids, cleanup := s.startZombieReporter(c, ZombiePolicy{DryRun: true}, func(r *http.Request) {
+		if r.Method == "DELETE" {
+			atomic.AddInt32(&deleteCount, 1)
+		}
+	})
+	defer cleanup()
+	var logOutput bytes.Buffer
+	bslog.Logger = log.New(&logOutput, "", 0)
+	reporter.reportStatus()
+	reporter.waitPendingRemovals()
+	c.Assert(atomic.LoadInt32(&deleteCount), check.Equals, int32(0))
+	c.Assert(reporter.LastReport().Zombies, check.DeepEquals, []ZombieState{
+		{ID: ids[0], Cycles: 1, Action: "dry-run"},
+		{ID: ids[1], Cycles: 1, Action: "dry-run"},
+		{ID: ids[2], Cycles: 1, Action: "dry-run"},
+	})
+	c.Assert(strings.Count(logOutput.String(), "dry-run: would remove container"), check.Equals, 3)
+}
+
+func (s S) TestReportStatusZombieStop(c *check.C) {
+	var deleteCount, stopCount int32
+	reporter, ids, cleanup := s.startZombieReporter(c, ZombiePolicy{Stop: true, MaxRemovals: 1}, func(r *http.Request) {
+		if r.Method == "DELETE" {
+			atomic.AddInt32(&deleteCount, 1)
+		}
+		if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/stop") {
+			atomic.AddInt32(&stopCount, 1)
+		}
+	})
+	defer cleanup()
+	// The first report, sent when the reporter starts, stopped the first
+	// container.
+	c.Assert(atomic.LoadInt32(&stopCount), check.Equals, int32(1))
+	var logOutput bytes.Buffer
+	bslog.Logger = log.New(&logOutput, "", 0)
+	reporter.reportStatus()
+	reporter.waitPendingRemovals()
+	c.Assert(atomic.LoadInt32(&stopCount), check.Equals, int32(2))
+	c.Assert(reporter.LastReport().Zombies, check.DeepEquals, []ZombieState{
+		{ID: ids[0], Cycles: 1, Action: "stopped"},
+		{ID: ids[1], Cycles: 1, Action: "stopping"},
+		{ID: ids[2], Cycles: 1, Action: "capped"},
+	})
+	reporter.reportStatus()
+	reporter.waitPendingRemovals()
+	c.Assert(atomic.LoadInt32(&stopCount), check.Equals, int32(3))
+	c.Assert(reporter.LastReport().Zombies, check.DeepEquals, []ZombieState{
+		{ID: ids[0], Cycles: 2, Action: "stopped"},
+		{ID: ids[1], Cycles: 2, Action: "stopped"},
+		{ID: ids[2], Cycles: 2, Action: "stopping"},
+	})
+	reporter.reportStatus()
+	reporter.waitPendingRemovals()
+	c.Assert(atomic.LoadInt32(&stopCount), check.Equals, int32(3))
+	c.Assert(atomic.LoadInt32(&deleteCount), check.Equals, int32(0))
+	c.Assert(logOutput.String(), check.Not(check.Matches), `(?s).*failed to stop.*`)
+}
+
+func (s S) TestReportStatusZombieRemovalFailureNotCounted(c *check.C) {
+	removed := zombiesRemoved.Value()
+	reporter, ids, cleanup := s.startZombieReporter(c, ZombiePolicy{}, nil)
+	defer cleanup()
+	c.Assert(zombiesRemoved.Value(), check.Equals, removed+uint64(len(ids)))
+	// The containers were removed by the first report, removing them again
+	// fails.
+	reporter.reportStatus()
+	reporter.waitPendingRemovals()
+	c.Assert(zombiesRemoved.Value(), check.Equals, removed+uint64(len(ids)))
+}
@@ -0,0 +1,109 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package telemetry provides a registry of counters and gauges describing
+// bs itself, exported through the metric backend and the local HTTP server.
+package telemetry
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+var registry = struct {
+	sync.Mutex
+	counters map[string]*Counter
+	gauges   map[string]func() float64
+}{
+	counters: make(map[string]*Counter),
+	gauges:   make(map[string]func() float64),
+}
+
+// Counter is a monotonically increasing value. The zero value and a nil
+// *Counter are valid, the latter ignoring every update.
+type Counter struct {
+	value uint64
+}
+
+// NewCounter returns the counter registered with name, registering a new one
+// if needed.
+func NewCounter(name string) *Counter {
+	registry.Lock()
+	defer registry.Unlock()
+	c := registry.counters[name]
+	if c == nil {
+		c = &Counter{}
+		registry.counters[name] = c
+	}
+	return c
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.value, n)
+}
+
+func (c *Counter) Value() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.value)
+}
+
+// RegisterGauge registers fn to be called to compute the value of the gauge
+// name, replacing any previously registered function.
+func RegisterGauge(name string, fn func() float64) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.gauges[name] = fn
+}
+
+// Snapshot returns the current value of every counter and gauge.
+func Snapshot() map[string]float64 {
+	registry.Lock()
+	counters := make(map[string]*Counter, len(registry.counters))
+	for name, c := range registry.counters {
+		counters[name] = c
+	}
+	gauges := make(map[string]func() float64, len(registry.gauges))
+	for name, fn := range registry.gauges {
+		gauges[name] = fn
+	}
+	registry.Unlock()
+	values := make(map[string]float64, len(counters)+len(gauges))
+	for name, c := range counters {
+		values[name] = float64(c.Value())
+	}
+	for name, fn := range gauges {
+		values[name] = fn()
+	}
+	return values
+}
+
+// Handler returns an http.Handler writing every value in the registry, one
+// "name value" pair per line, sorted by name.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		values := Snapshot()
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, name := range names {
+			fmt.Fprintf(w, "%s %s\n", name, strconv.FormatFloat(values[name], 'f', -1, 64))
+		}
+	})
+}
@@ -0,0 +1,48 @@
+// Copyright 2026 bs authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(S{})
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+func (S) TestCounter(c *check.C) {
+	counter := NewCounter("bs_test_counter")
+	c.Assert(NewCounter("bs_test_counter"), check.Equals, counter)
+	counter.Inc()
+	counter.Add(2)
+	c.Assert(counter.Value(), check.Equals, uint64(3))
+	var nilCounter *Counter
+	nilCounter.Inc()
+	c.Assert(nilCounter.Value(), check.Equals, uint64(0))
+}
+
+func (S) TestSnapshotAndHandler(c *check.C) {
+	NewCounter("bs_test_snapshot").Add(5)
+	RegisterGauge("bs_test_gauge", func() float64 { return 1.5 })
+	values := Snapshot()
+	c.Assert(values["bs_test_snapshot"], check.Equals, float64(5))
+	c.Assert(values["bs_test_gauge"], check.Equals, 1.5)
+	RegisterGauge("bs_test_gauge", func() float64 { return 2 })
+	c.Assert(Snapshot()["bs_test_gauge"], check.Equals, float64(2))
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/metrics", nil)
+	c.Assert(err, check.IsNil)
+	Handler().ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Matches, `(?s)(.*\n)?bs_test_gauge 2\n(.*\n)?bs_test_snapshot 5\n.*`)
+}